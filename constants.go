@@ -3,6 +3,8 @@ package tincd
 import "time"
 
 const (
-	GreetInterval     = 5 * time.Second // interval between attempts to "greet" new nodes
-	CommunicationPort = 4655            // default communication port inside VPN
+	GreetInterval      = 5 * time.Second  // interval between attempts to "greet" new nodes
+	CommunicationPort  = 4655             // default communication port inside VPN
+	PathMTUInterval    = time.Minute      // interval between requests of path MTU from tincd
+	DefaultGracePeriod = 10 * time.Second // time for tincd to stop gracefully before kill
 )
@@ -0,0 +1,59 @@
+package tincd
+
+import (
+	"fmt"
+	"github.com/tinc-boot/tincd/runner"
+)
+
+// Ask tincd to reload configuration and host files
+func (impl *netImpl) Reload() error {
+	return runner.Reload(impl.definition.Pidfile())
+}
+
+// Ask tincd to forget unreachable nodes
+func (impl *netImpl) Purge() error {
+	return runner.Purge(impl.definition.Pidfile())
+}
+
+// Ask tincd to retry outgoing connections immediately
+func (impl *netImpl) Retry() error {
+	return runner.Retry(impl.definition.Pidfile())
+}
+
+// Change debug level of tincd (requires tinc 1.1). Peers tracking requires level 3 or more
+func (impl *netImpl) SetDebugLevel(level int) error {
+	if !impl.caps.ControlSocket {
+		return fmt.Errorf("set debug level with tincd %s: %w", impl.caps.Version, runner.ErrNotSupported)
+	}
+	return runner.SetDebugLevel(impl.definition.Pidfile(), level)
+}
+
+// Connect to public node immediately. Node should have public address, so it is listed in ConnectTo
+func (impl *netImpl) Connect(node string) error {
+	info, err := impl.findNode(node)
+	if err != nil {
+		return err
+	}
+	if len(info.Address) == 0 {
+		return fmt.Errorf("node %s has no public address", info.Name)
+	}
+	if err := impl.definition.IndexPublicNodes(); err != nil {
+		return fmt.Errorf("index public nodes: %w", err)
+	}
+	if err := impl.Reload(); err != nil {
+		return err
+	}
+	return impl.Retry()
+}
+
+// Close meta connection with node (requires tinc 1.1). Node may connect again later
+func (impl *netImpl) Disconnect(node string) error {
+	if !impl.caps.ControlSocket {
+		return fmt.Errorf("disconnect with tincd %s: %w", impl.caps.Version, runner.ErrNotSupported)
+	}
+	info, err := impl.findNode(node)
+	if err != nil {
+		return err
+	}
+	return runner.Disconnect(impl.definition.Pidfile(), info.Name)
+}
@@ -0,0 +1,86 @@
+package tincd
+
+import (
+	"context"
+	"fmt"
+	"github.com/tinc-boot/tincd/network"
+	"net"
+	"strconv"
+	"strings"
+)
+
+func (impl *netImpl) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ip, err := impl.resolve(host, network)
+	if err != nil {
+		return nil, err
+	}
+	target := net.JoinHostPort(ip, port)
+	if impl.stack != nil {
+		return impl.stack.DialContext(ctx, network, target)
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, target)
+}
+
+func (impl *netImpl) Listen(port int) (net.Listener, error) {
+	self, err := impl.definition.Self()
+	if err != nil {
+		return nil, err
+	}
+	if self.PreferredIP() == "" {
+		return nil, fmt.Errorf("node %s has no VPN address", self.Name)
+	}
+	address := net.JoinHostPort(self.PreferredIP(), strconv.Itoa(port))
+	if impl.stack != nil {
+		return impl.stack.Listen("tcp", address)
+	}
+	return net.Listen("tcp", address)
+}
+
+// resolve node name or <node>.<network> to VPN address of requested family (tcp4/tcp6). IP is returned as-is
+func (impl *netImpl) resolve(host string, family string) (string, error) {
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+	node, err := impl.findNode(strings.TrimSuffix(strings.TrimSuffix(host, "."), "."+impl.definition.Name()))
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", host, err)
+	}
+	var ip string
+	switch {
+	case strings.HasSuffix(family, "4"):
+		ip = node.IP
+	case strings.HasSuffix(family, "6"):
+		ip = node.IP6
+	default:
+		ip = node.PreferredIP()
+	}
+	if ip == "" {
+		return "", fmt.Errorf("resolve %s: node %s has no VPN address for %s", host, node.Name, family)
+	}
+	return ip, nil
+}
+
+// find node by name (case-insensitive, as in DNS)
+func (impl *netImpl) findNode(name string) (*network.Node, error) {
+	if !network.IsValidNodeName(name) {
+		return nil, fmt.Errorf("%w %s", network.ErrInvalidNodeName, name)
+	}
+	if node, err := impl.definition.Node(name); err == nil {
+		return node, nil
+	}
+	nodes, err := impl.definition.NodesDefinitions()
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		if strings.EqualFold(node.Name, name) {
+			return &node, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown node %s", name)
+}
@@ -0,0 +1,53 @@
+package tincd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNetImpl_resolve(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+
+	ntw, err := Create(filepath.Join(tmp, "dial"), "10.10.0.0/16", "fd00:10::/64")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	self, err := ntw.Self()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	impl := &netImpl{definition: ntw}
+	for host, expected := range map[string]string{
+		self.Name:            self.IP,
+		self.Name + ".dial":  self.IP,
+		self.Name + ".dial.": self.IP,
+		"10.10.0.1":          "10.10.0.1",
+		"fd00:10::1":         "fd00:10::1",
+	} {
+		ip, err := impl.resolve(host, "tcp")
+		if err != nil {
+			t.Error(host, err)
+			continue
+		}
+		if ip != expected {
+			t.Errorf("%s resolved to %s instead of %s", host, ip, expected)
+		}
+	}
+	if ip, err := impl.resolve(self.Name, "tcp6"); err != nil || ip != self.IP6 {
+		t.Errorf("IPv6 of %s resolved to %s (%v)", self.Name, ip, err)
+	}
+	for _, host := range []string{"unknown", "../" + self.Name} {
+		if _, err := impl.resolve(host, "tcp"); err == nil {
+			t.Error(host, "resolved")
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package tincd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/reddec/jsonrpc2"
+	"github.com/tinc-boot/tincd/internal/api"
+	"github.com/tinc-boot/tincd/network"
+	"github.com/tinc-boot/tincd/runner"
+	"os/exec"
+	"syscall"
+)
+
+// Errors of public API. Returned errors wrap them with details, so use errors.Is and errors.As (see ErrTincExited)
+var (
+	ErrNotDefined         = network.ErrNotDefined
+	ErrInvalidNodeName    = network.ErrInvalidNodeName
+	ErrSubnetMismatch     = network.ErrSubnetMismatch
+	ErrOutdatedVersion    = network.ErrOutdatedVersion
+	ErrTincNotFound       = errors.New("tincd binary not found")
+	ErrAlreadyRunning     = errors.New("network is already served by another tincd instance")
+	ErrPrivilegeDenied    = runner.ErrPrivilegeDenied // privileges not granted (sudo cancelled) or not enough
+	ErrUnsupportedVersion = runner.ErrUnsupportedVersion
+)
+
+// Number of last log lines in ErrTincExited
+const ExitLogLines = 20
+
+// Tincd exited: stopped by user (Stopped, unwraps to context.Canceled) or unexpectedly
+type ErrTincExited struct {
+	Code         int      // exit code (-1 if unknown or killed by signal)
+	Signal       string   // signal which killed tincd (if any)
+	Stopped      bool     // stopped by user (see Tincd.Stop)
+	LastLogLines []string // last lines of tincd log (ex: "Could not open /dev/net/tun")
+}
+
+func (e *ErrTincExited) Error() string {
+	var msg string
+	switch {
+	case e.Stopped:
+		return "tincd stopped"
+	case e.Signal != "":
+		msg = "tincd killed by signal " + e.Signal
+	default:
+		msg = fmt.Sprintf("tincd exited with code %d", e.Code)
+	}
+	if len(e.LastLogLines) > 0 {
+		msg += ": " + e.LastLogLines[len(e.LastLogLines)-1]
+	}
+	return msg
+}
+
+func (e *ErrTincExited) Unwrap() error {
+	if e.Stopped {
+		return context.Canceled
+	}
+	return nil
+}
+
+// JSON-RPC error codes of greeting API
+const (
+	CodeNotDefined      = -30001
+	CodeInvalidNodeName = -30002
+	CodeSubnetMismatch  = -30003
+	CodeOutdatedVersion = -30004
+	CodeAlreadyRunning  = -30005
+)
+
+var rpcErrors = map[int]error{
+	CodeNotDefined:      ErrNotDefined,
+	CodeInvalidNodeName: ErrInvalidNodeName,
+	CodeSubnetMismatch:  ErrSubnetMismatch,
+	CodeOutdatedVersion: ErrOutdatedVersion,
+	CodeAlreadyRunning:  ErrAlreadyRunning,
+}
+
+// convert known error to JSON-RPC error with code
+func toRPCError(err error) error {
+	for code, known := range rpcErrors {
+		if errors.Is(err, known) {
+			return &jsonrpc2.Error{Code: code, Message: err.Error()}
+		}
+	}
+	return err
+}
+
+// convert JSON-RPC error with known code to error which wraps sentinel error
+func fromRPCError(err error) error {
+	var rpcErr *jsonrpc2.Error
+	if !errors.As(err, &rpcErr) {
+		return err
+	}
+	if known, ok := rpcErrors[rpcErr.Code]; ok {
+		return &remoteError{message: rpcErr.Message, err: known}
+	}
+	return err
+}
+
+// error returned by remote node
+type remoteError struct {
+	message string
+	err     error
+}
+
+func (re *remoteError) Error() string { return "remote: " + re.message }
+
+func (re *remoteError) Unwrap() error { return re.err }
+
+// API client with errors converted back from JSON-RPC codes
+type rpcErrorsClient struct {
+	api.API
+}
+
+func (client *rpcErrorsClient) Exchange(ctx context.Context, self network.Node) ([]network.Node, error) {
+	nodes, err := client.API.Exchange(ctx, self)
+	return nodes, fromRPCError(err)
+}
+
+// details of exit by result of process wait
+func newExitError(err error, stopped bool, lastLines []string) *ErrTincExited {
+	exit := &ErrTincExited{Stopped: stopped, LastLogLines: lastLines}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		exit.Code = exitErr.ExitCode()
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			exit.Signal = status.Signal().String()
+		}
+	case err != nil:
+		exit.Code = -1
+	}
+	return exit
+}
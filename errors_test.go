@@ -0,0 +1,64 @@
+package tincd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/reddec/jsonrpc2"
+	"github.com/tinc-boot/tincd/network"
+	"github.com/tinc-boot/tincd/runner"
+	"os/exec"
+	"runtime"
+	"testing"
+)
+
+func TestRPCErrors(t *testing.T) {
+	err := toRPCError(fmt.Errorf("%w for network (10.10.0.0/16)", network.ErrSubnetMismatch))
+	var rpcErr *jsonrpc2.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != CodeSubnetMismatch {
+		t.Fatalf("unexpected JSON-RPC error: %v", err)
+	}
+	if err := fromRPCError(err); !errors.Is(err, ErrSubnetMismatch) {
+		t.Errorf("sentinel error not restored: %v", err)
+	}
+	err = toRPCError(fmt.Errorf("%w: network alfa, pid 123", ErrAlreadyRunning))
+	if err := fromRPCError(err); !errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("sentinel error not restored: %v", err)
+	}
+	other := errors.New("other")
+	if toRPCError(other) != other || fromRPCError(other) != other {
+		t.Error("unknown errors should be passed as is")
+	}
+}
+
+func TestNewExitError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no shell")
+	}
+	exit := newExitError(exec.Command("sh", "-c", "exit 3").Run(), false, []string{"Could not open /dev/net/tun"})
+	if exit.Code != 3 || exit.Signal != "" || exit.Error() != "tincd exited with code 3: Could not open /dev/net/tun" {
+		t.Errorf("unexpected exit: %+v", exit)
+	}
+	exit = newExitError(exec.Command("sh", "-c", "kill -9 $$").Run(), false, nil)
+	if exit.Signal != "killed" {
+		t.Errorf("unexpected exit: %+v", exit)
+	}
+	if exit = newExitError(nil, true, nil); !errors.Is(exit, context.Canceled) {
+		t.Error("user stop should be context.Canceled")
+	}
+}
+
+func TestPrivilegeDenied(t *testing.T) {
+	for _, cause := range []error{runner.ErrSudoCancelled, runner.ErrPermissionDenied} {
+		err := &runner.StartError{Args: []string{"tincd"}, Err: cause}
+		if !errors.Is(err, ErrPrivilegeDenied) || !errors.Is(err, cause) {
+			t.Errorf("unexpected match of %v", err)
+		}
+	}
+	if errors.Is(fmt.Errorf("%w: signal tincd", runner.ErrPermissionDenied), runner.ErrSudoCancelled) {
+		t.Error("permission denied should not match cancelled sudo")
+	}
+	if errors.Is(runner.ErrBinaryNotFound, ErrPrivilegeDenied) {
+		t.Error("binary not found should not match privilege denied")
+	}
+}
@@ -5,4 +5,7 @@ go 1.13
 require (
 	github.com/phayes/permbits v0.0.0-20190612203442-39d7c581d2ee
 	github.com/reddec/jsonrpc2 v0.1.18-0.20200514125425-e010095d0a08
+	github.com/stretchr/testify v1.5.1
+	github.com/vishvananda/netlink v1.1.0
+	golang.org/x/net v0.0.0-20190620200207-3b0461eec859
 )
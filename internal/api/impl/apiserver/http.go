@@ -14,6 +14,11 @@ func RunHTTP(global context.Context, network, binding string, handler api.API) e
 	if err != nil {
 		return err
 	}
+	return ServeHTTP(global, listener, handler)
+}
+
+// Serve API on provided listener. Listener is closed after return
+func ServeHTTP(global context.Context, listener net.Listener, handler api.API) error {
 	var router jsonrpc2.Router
 	RegisterAPI(&router, handler)
 	server := http.Server{
@@ -0,0 +1,175 @@
+package dnsserver
+
+import (
+	"context"
+	"github.com/tinc-boot/tincd/network"
+	"golang.org/x/net/dns/dnsmessage"
+	"log"
+	"net"
+	"strings"
+	"sync"
+)
+
+const ttl = 60 // seconds
+
+// DNS server for nodes of single network. Answers A, AAAA for <node>.<zone> and PTR for VPN addresses.
+type Server struct {
+	zone  string // fully qualified lower-case zone, ex: mynet.
+	lock  sync.RWMutex
+	names map[string]network.Node // fqdn -> node
+	ptr   map[string]string       // reverse name -> fqdn
+}
+
+// New server for zone (usually network name)
+func New(zone string) *Server {
+	return &Server{zone: strings.ToLower(strings.Trim(zone, ".")) + "."}
+}
+
+// Replace records by nodes definitions
+func (srv *Server) Update(nodes []network.Node) {
+	var names = make(map[string]network.Node, len(nodes))
+	var ptr = make(map[string]string, len(nodes))
+	for _, node := range nodes {
+		fqdn := strings.ToLower(node.Name) + "." + srv.zone
+		names[fqdn] = node
+		for _, addr := range []string{node.IP, node.IP6} {
+			if reverse := reverseName(net.ParseIP(addr)); reverse != "" {
+				ptr[reverse] = fqdn
+			}
+		}
+	}
+	srv.lock.Lock()
+	srv.names = names
+	srv.ptr = ptr
+	srv.lock.Unlock()
+}
+
+// Serve DNS requests over UDP till context canceled
+func (srv *Server) Run(ctx context.Context, address string) error {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+	var buffer [512]byte
+	for {
+		n, remote, err := conn.ReadFrom(buffer[:])
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		reply, err := srv.Answer(buffer[:n])
+		if err != nil {
+			log.Println("dns: request from", remote, ":", err)
+			continue
+		}
+		if _, err := conn.WriteTo(reply, remote); err != nil {
+			log.Println("dns: reply to", remote, ":", err)
+		}
+	}
+}
+
+// Answer for raw DNS request
+func (srv *Server) Answer(request []byte) ([]byte, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(request)
+	if err != nil {
+		return nil, err
+	}
+	question, err := parser.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	header.Response = true
+	header.Authoritative = true
+	header.RecursionAvailable = false
+	header.RCode = dnsmessage.RCodeSuccess
+
+	name := strings.ToLower(question.Name.String())
+	srv.lock.RLock()
+	node, known := srv.names[name]
+	target, knownPtr := srv.ptr[name]
+	srv.lock.RUnlock()
+
+	switch {
+	case question.Type == dnsmessage.TypePTR && knownPtr:
+	case question.Type == dnsmessage.TypePTR && isReverseZone(name):
+		header.RCode = dnsmessage.RCodeNameError
+	case !strings.HasSuffix(name, "."+srv.zone):
+		header.RCode = dnsmessage.RCodeRefused
+	case !known:
+		header.RCode = dnsmessage.RCodeNameError
+	}
+
+	builder := dnsmessage.NewBuilder(nil, header)
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(question); err != nil {
+		return nil, err
+	}
+	if err := builder.StartAnswers(); err != nil {
+		return nil, err
+	}
+	if header.RCode == dnsmessage.RCodeSuccess {
+		resource := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: ttl}
+		switch question.Type {
+		case dnsmessage.TypeA:
+			if ip := net.ParseIP(node.IP).To4(); ip != nil {
+				var record dnsmessage.AResource
+				copy(record.A[:], ip)
+				err = builder.AResource(resource, record)
+			}
+		case dnsmessage.TypeAAAA:
+			if ip := net.ParseIP(node.IP6); ip != nil {
+				var record dnsmessage.AAAAResource
+				copy(record.AAAA[:], ip.To16())
+				err = builder.AAAAResource(resource, record)
+			}
+		case dnsmessage.TypePTR:
+			if knownPtr {
+				var ptrName dnsmessage.Name
+				ptrName, err = dnsmessage.NewName(target)
+				if err == nil {
+					err = builder.PTRResource(resource, dnsmessage.PTRResource{PTR: ptrName})
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return builder.Finish()
+}
+
+func isReverseZone(name string) bool {
+	return strings.HasSuffix(name, ".in-addr.arpa.") || strings.HasSuffix(name, ".ip6.arpa.")
+}
+
+// reverse name (in-addr.arpa or ip6.arpa) of address
+func reverseName(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return net.IPv4(v4[3], v4[2], v4[1], v4[0]).String() + ".in-addr.arpa."
+	}
+	const hexDigits = "0123456789abcdef"
+	var out strings.Builder
+	ip = ip.To16()
+	for i := len(ip) - 1; i >= 0; i-- {
+		out.WriteByte(hexDigits[ip[i]&0xF])
+		out.WriteByte('.')
+		out.WriteByte(hexDigits[ip[i]>>4])
+		out.WriteByte('.')
+	}
+	out.WriteString("ip6.arpa.")
+	return out.String()
+}
@@ -0,0 +1,52 @@
+package dnsserver
+
+import (
+	"context"
+	"github.com/tinc-boot/tincd/network"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServer_Run(t *testing.T) {
+	srv := New("mynet")
+	srv.Update([]network.Node{{Name: "Alfa_1", IP: "10.10.1.2", IP6: "fd00::2"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	address := conn.LocalAddr().String()
+	_ = conn.Close()
+	go func() { _ = srv.Run(ctx, address) }()
+	time.Sleep(100 * time.Millisecond)
+
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("udp", address)
+		},
+	}
+	ips, err := resolver.LookupIPAddr(ctx, "alfa_1.mynet")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(ips) != 2 {
+		t.Errorf("expected IPv4 and IPv6, got %v", ips)
+	}
+	names, err := resolver.LookupAddr(ctx, "10.10.1.2")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(names) != 1 || names[0] != "alfa_1.mynet." {
+		t.Errorf("unexpected reverse names: %v", names)
+	}
+	if _, err := resolver.LookupIPAddr(ctx, "beta.mynet"); err == nil {
+		t.Error("unknown node resolved")
+	}
+}
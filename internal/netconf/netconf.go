@@ -0,0 +1,17 @@
+package netconf
+
+import (
+	"net"
+	"time"
+)
+
+// How long to wait for interface created by tincd
+const WaitInterface = 30 * time.Second
+
+// Interface settings applied natively (without tinc-up/tinc-down scripts)
+type Settings struct {
+	Name      string       // interface name
+	MTU       int          // interface MTU (0 means OS default)
+	Addresses []*net.IPNet // VPN addresses with network mask
+	Routes    []*net.IPNet // routes to subnets behind other nodes
+}
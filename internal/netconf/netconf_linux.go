@@ -0,0 +1,147 @@
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Wait for interface (up to WaitInterface), assign addresses and MTU, bring it up and add routes.
+// Could be called several times: already applied settings are replaced, global addresses which are not in settings
+// anymore (ex: after network.ReassignIP) are removed (interface is owned by tincd).
+func Apply(ctx context.Context, settings Settings) error {
+	link, err := waitLink(ctx, settings.Name)
+	if err != nil {
+		return err
+	}
+	if err := removeStaleAddresses(link, settings); err != nil {
+		return err
+	}
+	for _, address := range settings.Addresses {
+		if err := netlink.AddrReplace(link, &netlink.Addr{IPNet: address}); err != nil {
+			return fmt.Errorf("assign address %s to %s: %w", address, settings.Name, err)
+		}
+	}
+	if settings.MTU != 0 {
+		if err := netlink.LinkSetMTU(link, settings.MTU); err != nil {
+			return fmt.Errorf("set MTU %d for %s: %w", settings.MTU, settings.Name, err)
+		}
+	}
+	if err := netlink.LinkSetUp(link); err != nil {
+		return fmt.Errorf("set %s up: %w", settings.Name, err)
+	}
+	for _, subnet := range settings.Routes {
+		if err := netlink.RouteReplace(route(link, subnet)); err != nil {
+			return fmt.Errorf("add route %s via %s: %w", subnet, settings.Name, err)
+		}
+	}
+	return nil
+}
+
+// Add (or replace) route to subnet via interface
+func AddRoute(name string, subnet *net.IPNet) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return fmt.Errorf("find interface %s: %w", name, err)
+	}
+	if err := netlink.RouteReplace(route(link, subnet)); err != nil {
+		return fmt.Errorf("add route %s via %s: %w", subnet, name, err)
+	}
+	return nil
+}
+
+// Revert settings applied by Apply (as tinc-down script does): remove routes and addresses, bring interface down.
+// Missed interface, addresses or routes are ignored
+func Reset(settings Settings) error {
+	link, err := netlink.LinkByName(settings.Name)
+	if err != nil {
+		return nil
+	}
+	if err := RemoveRoutes(settings.Name, settings.Routes); err != nil {
+		return err
+	}
+	for _, address := range settings.Addresses {
+		if err := netlink.AddrDel(link, &netlink.Addr{IPNet: address}); err != nil && !isNotAssigned(err) {
+			return fmt.Errorf("remove address %s from %s: %w", address, settings.Name, err)
+		}
+	}
+	if err := netlink.LinkSetDown(link); err != nil {
+		return fmt.Errorf("set %s down: %w", settings.Name, err)
+	}
+	return nil
+}
+
+// Remove routes previously added by Apply. Missed interface or routes are ignored
+func RemoveRoutes(name string, routes []*net.IPNet) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return nil
+	}
+	for _, subnet := range routes {
+		if err := netlink.RouteDel(route(link, subnet)); err != nil && !isNotExist(err) {
+			return fmt.Errorf("remove route %s via %s: %w", subnet, name, err)
+		}
+	}
+	return nil
+}
+
+// remove global addresses of interface which are not in settings. Link-local addresses are kept
+func removeStaleAddresses(link netlink.Link, settings Settings) error {
+	assigned, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return fmt.Errorf("list addresses of %s: %w", settings.Name, err)
+	}
+	var actual = make(map[string]bool, len(settings.Addresses))
+	for _, address := range settings.Addresses {
+		actual[address.String()] = true
+	}
+	for _, addr := range assigned {
+		if addr.Scope != int(netlink.SCOPE_UNIVERSE) || actual[addr.IPNet.String()] {
+			continue
+		}
+		if err := netlink.AddrDel(link, &addr); err != nil && !isNotAssigned(err) {
+			return fmt.Errorf("remove stale address %s from %s: %w", addr.IPNet, settings.Name, err)
+		}
+	}
+	return nil
+}
+
+func route(link netlink.Link, subnet *net.IPNet) *netlink.Route {
+	return &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       subnet,
+		Scope:     netlink.SCOPE_LINK,
+	}
+}
+
+func waitLink(ctx context.Context, name string) (netlink.Link, error) {
+	ctx, cancel := context.WithTimeout(ctx, WaitInterface)
+	defer cancel()
+	for {
+		link, err := netlink.LinkByName(name)
+		if err == nil {
+			return link, nil
+		}
+		if _, ok := err.(netlink.LinkNotFoundError); !ok {
+			return nil, fmt.Errorf("find interface %s: %w", name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("interface %s not created: %w", name, ctx.Err())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// kernel returns ESRCH for unknown routes
+func isNotExist(err error) bool {
+	return err == syscall.ESRCH
+}
+
+// kernel returns EADDRNOTAVAIL for unknown addresses
+func isNotAssigned(err error) bool {
+	return err == syscall.EADDRNOTAVAIL
+}
@@ -0,0 +1,51 @@
+package netconf
+
+import (
+	"context"
+	"github.com/vishvananda/netlink"
+	"net"
+	"testing"
+)
+
+func TestApply_staleAddresses(t *testing.T) {
+	const name = "tinctest0"
+	err := netlink.LinkAdd(&netlink.Tuntap{LinkAttrs: netlink.LinkAttrs{Name: name}, Mode: netlink.TUNTAP_MODE_TUN})
+	if err != nil {
+		t.Skip("tun device not created (CAP_NET_ADMIN required):", err)
+	}
+	defer func() {
+		if link, err := netlink.LinkByName(name); err == nil {
+			_ = netlink.LinkDel(link)
+		}
+	}()
+	settings := Settings{Name: name, Addresses: []*net.IPNet{{IP: net.ParseIP("10.10.1.2").To4(), Mask: net.CIDRMask(16, 32)}}}
+	if err := Apply(context.Background(), settings); err != nil {
+		t.Fatal(err)
+	}
+	// reassigned address
+	settings.Addresses = []*net.IPNet{{IP: net.ParseIP("10.10.1.3").To4(), Mask: net.CIDRMask(16, 32)}}
+	if err := Apply(context.Background(), settings); err != nil {
+		t.Fatal(err)
+	}
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assigned, err := netlink.AddrList(link, netlink.FAMILY_V4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assigned) != 1 || assigned[0].IPNet.String() != "10.10.1.3/16" {
+		t.Errorf("unexpected addresses: %v", assigned)
+	}
+	if err := Reset(settings); err != nil {
+		t.Fatal(err)
+	}
+	assigned, err = netlink.AddrList(link, netlink.FAMILY_V4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assigned) != 0 {
+		t.Errorf("addresses left after reset: %v", assigned)
+	}
+}
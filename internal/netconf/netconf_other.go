@@ -0,0 +1,30 @@
+// +build !linux
+
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// Native interface configuration is supported only on Linux
+func Apply(ctx context.Context, settings Settings) error {
+	return fmt.Errorf("native interface configuration is not supported on %s", runtime.GOOS)
+}
+
+// Native interface configuration is supported only on Linux
+func RemoveRoutes(name string, routes []*net.IPNet) error {
+	return nil
+}
+
+// Native interface configuration is supported only on Linux
+func AddRoute(name string, subnet *net.IPNet) error {
+	return fmt.Errorf("native interface configuration is not supported on %s", runtime.GOOS)
+}
+
+// Native interface configuration is supported only on Linux
+func Reset(settings Settings) error {
+	return nil
+}
@@ -0,0 +1,405 @@
+package tincd
+
+import (
+	"context"
+	"fmt"
+	"github.com/tinc-boot/tincd/internal"
+	"github.com/tinc-boot/tincd/network"
+	"github.com/tinc-boot/tincd/runner"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Manager of networks in one root directory (each sub-directory is a network, see network.List). Events of all
+// running networks are aggregated into one bus (payloads are tagged by network name). Administrative privileges
+// are asked only once for all networks (see NewManager). All methods are goroutine safe.
+type Manager struct {
+	root        string
+	sudo        bool
+	options     []Option
+	events      network.Events
+	lock        sync.Mutex
+	systemHosts string
+	networks    map[string]*managedNetwork // running or starting networks
+	stopHelper  func()                     // stop privileged helper started by manager
+}
+
+// running or starting network
+type managedNetwork struct {
+	iface    string        // kernel interface (empty for userspace networks)
+	ready    chan struct{} // closed after start attempt
+	instance Tincd         // set after successful start
+	err      error         // reason of failed start
+}
+
+// Create manager of networks in root directory. Sudo and options are applied to every started network.
+// If sudo is true, privileged helper is started (one prompt for all networks) and stopped by Shutdown, unless it
+// is already running, the process is already privileged or platform does not support it (Windows). In this case
+// embedding application should handle helper mode on start (see runner.IsHelperMode and runner.ServeHelper).
+func NewManager(root string, sudo bool, options ...Option) (*Manager, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	mgr := &Manager{
+		root:       abs,
+		sudo:       sudo,
+		options:    options,
+		networks:   make(map[string]*managedNetwork),
+		stopHelper: func() {},
+	}
+	if sudo && runtime.GOOS != "windows" && os.Geteuid() != 0 && !runner.IsHelperStarted() {
+		if err := mgr.startHelper(); err != nil {
+			return nil, err
+		}
+	}
+	return mgr, nil
+}
+
+// Aggregated events of all networks
+func (mgr *Manager) Events() *network.Events {
+	return &mgr.events
+}
+
+// Maintain marked block with known nodes of every network in hosts file (ex: /etc/hosts, see
+// network.Network.SystemHosts). Empty file disables it. Applied to networks started after the call
+func (mgr *Manager) SetSystemHosts(file string) {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+	mgr.systemHosts = file
+}
+
+// All defined networks in root directory
+func (mgr *Manager) Networks() ([]*network.Network, error) {
+	list, err := network.List(mgr.root)
+	if err != nil {
+		return nil, err
+	}
+	var ans []*network.Network
+	for _, nw := range list {
+		if nw.IsDefined() {
+			ans = append(ans, mgr.define(nw.Root))
+		}
+	}
+	return ans, nil
+}
+
+// Defined network by name
+func (mgr *Manager) Network(name string) (*network.Network, error) {
+	if !network.IsValidName(name) {
+		return nil, network.ErrInvalidName
+	}
+	nw := mgr.define(filepath.Join(mgr.root, name))
+	if !nw.IsDefined() {
+		return nil, fmt.Errorf("%w: %s", ErrNotDefined, name)
+	}
+	return nw, nil
+}
+
+// Running instance of network (if any)
+func (mgr *Manager) Instance(name string) (Tincd, bool) {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+	entry, ok := mgr.networks[name]
+	if !ok || entry.instance == nil {
+		return nil, false
+	}
+	return entry.instance, true
+}
+
+// Names of running networks
+func (mgr *Manager) Running() []string {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+	var ans []string
+	for name, entry := range mgr.networks {
+		if entry.instance != nil {
+			ans = append(ans, name)
+		}
+	}
+	sort.Strings(ans)
+	return ans
+}
+
+// Start network by name. Already running instance is returned as is, concurrent start of the same network waits
+// for the first one. Network which interface (see network.Config.Interface) is already used by another running
+// network is rejected
+func (mgr *Manager) Start(ctx context.Context, name string) (Tincd, error) {
+	nw, err := mgr.Network(name)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := nw.Read()
+	if err != nil {
+		return nil, err
+	}
+	entry := &managedNetwork{ready: make(chan struct{})}
+	if !cfg.Userspace() {
+		entry.iface = cfg.Interface
+	}
+
+	mgr.lock.Lock()
+	if current, ok := mgr.networks[name]; ok {
+		mgr.lock.Unlock()
+		return current.wait(ctx)
+	}
+	if other := mgr.interfaceUser(entry.iface); other != "" {
+		mgr.lock.Unlock()
+		return nil, fmt.Errorf("network %s: interface %s is already used by network %s", name, entry.iface, other)
+	}
+	mgr.networks[name] = entry
+	mgr.lock.Unlock()
+
+	// probe and start without lock: it could take a while (sudo prompt)
+	options := append(append([]Option{}, mgr.options...), forwardEvents(&mgr.events))
+	instance, err := Start(ctx, nw, mgr.sudo, options...)
+
+	mgr.lock.Lock()
+	if err != nil {
+		entry.err = err
+		delete(mgr.networks, name)
+	} else {
+		entry.instance = instance
+	}
+	close(entry.ready)
+	mgr.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		<-instance.Done()
+		mgr.release(name, entry)
+	}()
+	return instance, nil
+}
+
+// Stop network by name and wait for exit. Network being started is stopped after start. Does nothing if network
+// is not running
+func (mgr *Manager) Stop(name string, deadline ...time.Time) {
+	mgr.lock.Lock()
+	entry, ok := mgr.networks[name]
+	mgr.lock.Unlock()
+	if !ok {
+		return
+	}
+	<-entry.ready
+	if entry.instance == nil {
+		return
+	}
+	entry.instance.Stop(deadline...)
+	<-entry.instance.Done()
+	mgr.release(name, entry)
+}
+
+// Start all networks with auto-start flag (see SetAutoStart). Failed networks are logged and skipped, the first
+// error is returned
+func (mgr *Manager) StartAutoStart(ctx context.Context) error {
+	list, err := mgr.Networks()
+	if err != nil {
+		return err
+	}
+	var first error
+	for _, nw := range list {
+		cfg, err := nw.Read()
+		if err != nil || !cfg.AutoStart {
+			continue
+		}
+		if _, err := mgr.Start(ctx, nw.Name()); err != nil {
+			log.Println("auto-start", nw.Name(), ":", err)
+			if first == nil {
+				first = fmt.Errorf("auto-start %s: %w", nw.Name(), err)
+			}
+		}
+	}
+	return first
+}
+
+// Enable or disable auto-start of network (see Config.AutoStart)
+func (mgr *Manager) SetAutoStart(name string, enabled bool) error {
+	return mgr.updateConfig(name, func(cfg *network.Config) {
+		cfg.AutoStart = enabled
+	})
+}
+
+// Set custom hook of network scripts (see Config.Hook). Scripts are re-rendered on next start
+func (mgr *Manager) SetHook(name string, hook string) error {
+	return mgr.updateConfig(name, func(cfg *network.Config) {
+		cfg.Hook = hook
+	})
+}
+
+// Enable or disable native configuration of interface instead of scripts (see Config.NativeInterface). Applied on
+// next start
+func (mgr *Manager) SetNativeInterface(name string, enabled bool) error {
+	return mgr.updateConfig(name, func(cfg *network.Config) {
+		cfg.NativeInterface = enabled
+	})
+}
+
+// Stop all running networks and wait for exit, then stop privileged helper started by manager (next starts with
+// sudo will ask privileges for each network). Networks being started are stopped after start. Tincd processes are
+// killed after grace period or optional deadline
+func (mgr *Manager) Shutdown(deadline ...time.Time) {
+	mgr.lock.Lock()
+	var entries = make(map[string]*managedNetwork, len(mgr.networks))
+	for name, entry := range mgr.networks {
+		entries[name] = entry
+	}
+	mgr.lock.Unlock()
+	for _, entry := range entries {
+		<-entry.ready
+		if entry.instance != nil {
+			entry.instance.Stop(deadline...)
+		}
+	}
+	for name, entry := range entries {
+		if entry.instance != nil {
+			<-entry.instance.Done()
+			mgr.release(name, entry)
+		}
+	}
+	mgr.lock.Lock()
+	stopHelper := mgr.stopHelper
+	mgr.stopHelper = func() {}
+	mgr.lock.Unlock()
+	stopHelper()
+}
+
+// start privileged helper in temporary directory for all networks
+func (mgr *Manager) startHelper() error {
+	tincBin, err := internal.DetectTincBinary()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTincNotFound, err)
+	}
+	dir, err := ioutil.TempDir("", "tinc-helper")
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := runner.StartHelper(ctx, filepath.Join(dir, "socket"), tincBin); err != nil {
+		cancel()
+		_ = os.RemoveAll(dir)
+		return err
+	}
+	mgr.stopHelper = func() {
+		cancel()
+		_ = os.RemoveAll(dir)
+	}
+	return nil
+}
+
+// network definition with manager settings
+func (mgr *Manager) define(root string) *network.Network {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+	return &network.Network{Root: root, SystemHosts: mgr.systemHosts}
+}
+
+// read, modify and save network configuration
+func (mgr *Manager) updateConfig(name string, update func(cfg *network.Config)) error {
+	nw, err := mgr.Network(name)
+	if err != nil {
+		return err
+	}
+	cfg, err := nw.Read()
+	if err != nil {
+		return err
+	}
+	update(cfg)
+	return nw.Update(cfg)
+}
+
+// forget stopped network (if it was not replaced by new start)
+func (mgr *Manager) release(name string, entry *managedNetwork) {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+	if mgr.networks[name] == entry {
+		delete(mgr.networks, name)
+	}
+}
+
+// name of running or starting network which uses interface. Should be called under lock
+func (mgr *Manager) interfaceUser(iface string) string {
+	if iface == "" {
+		return ""
+	}
+	for name, entry := range mgr.networks {
+		if entry.iface == iface {
+			return name
+		}
+	}
+	return ""
+}
+
+// wait for start attempt of network
+func (entry *managedNetwork) wait(ctx context.Context) (Tincd, error) {
+	select {
+	case <-entry.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	return entry.instance, nil
+}
+
+// forward events of instance to aggregated bus. Subscribed before start, so no events are lost
+func forwardEvents(bus *network.Events) Option {
+	return func(impl *netImpl) {
+		impl.events.SubscribeAll(&forwarder{target: bus})
+	}
+}
+
+// forwarder of events, detached from target after stop to not keep references of stopped instances
+type forwarder struct {
+	lock   sync.RWMutex
+	target *network.Events
+}
+
+func (fw *forwarder) bus() *network.Events {
+	fw.lock.RLock()
+	defer fw.lock.RUnlock()
+	return fw.target
+}
+
+func (fw *forwarder) Stopped(payload network.NetworkID) {
+	fw.lock.Lock()
+	target := fw.target
+	fw.target = nil
+	fw.lock.Unlock()
+	if target != nil {
+		target.Stopped.Emit(payload)
+	}
+}
+
+func (fw *forwarder) ConfigChanged(payload network.NetworkID) {
+	if target := fw.bus(); target != nil {
+		target.ConfigChanged.Emit(payload)
+	}
+}
+
+func (fw *forwarder) PeerDiscovered(payload network.PeerID) {
+	if target := fw.bus(); target != nil {
+		target.PeerDiscovered.Emit(payload)
+	}
+}
+
+func (fw *forwarder) PeerJoined(payload network.PeerID) {
+	if target := fw.bus(); target != nil {
+		target.PeerJoined.Emit(payload)
+	}
+}
+
+func (fw *forwarder) PeerLeft(payload network.PeerID) {
+	if target := fw.bus(); target != nil {
+		target.PeerLeft.Emit(payload)
+	}
+}
@@ -0,0 +1,210 @@
+package tincd
+
+import (
+	"context"
+	"errors"
+	"github.com/tinc-boot/tincd/network"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestManager_SetAutoStart(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	for _, name := range []string{"alfa", "beta"} {
+		if _, err := Create(filepath.Join(tmp, name), "10.10.0.0/16"); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	mgr, err := NewManager(tmp, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	list, err := mgr.Networks()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(list) != 2 {
+		t.Errorf("expected 2 networks, got %d", len(list))
+	}
+	if _, err := mgr.Network("gamma"); !errors.Is(err, ErrNotDefined) {
+		t.Error("unknown network should not be defined:", err)
+	}
+	if err := mgr.SetAutoStart("beta", true); err != nil {
+		t.Error(err)
+		return
+	}
+	nw, err := mgr.Network("beta")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	cfg, err := nw.Read()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !cfg.AutoStart {
+		t.Error("auto-start not saved")
+	}
+	if _, err := mgr.Start(context.Background(), "../beta"); err == nil {
+		t.Error("invalid network name accepted")
+	}
+	if len(mgr.Running()) != 0 {
+		t.Error("nothing should be running")
+	}
+	mgr.Shutdown()
+}
+
+func TestManager_StartAutoStart(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake tincd is a shell script")
+	}
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	bin := filepath.Join(tmp, "bin")
+	if err := os.Mkdir(bin, 0755); err != nil {
+		t.Error(err)
+		return
+	}
+	fake := "#!/bin/sh\n" +
+		"if [ \"$1\" = \"--version\" ]; then echo 'tinc version 1.0.36'; exit 0; fi\n" +
+		"trap 'exit 0' TERM\ntrap '' HUP USR2\nwhile true; do sleep 0.1; done\n"
+	if err := ioutil.WriteFile(filepath.Join(bin, "tincd"), []byte(fake), 0755); err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	_ = os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	root := filepath.Join(tmp, "networks")
+	for _, name := range []string{"alfa", "beta", "gamma"} {
+		nw, err := Create(filepath.Join(root, name), "10.10.0.0/16")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if name == "gamma" {
+			continue
+		}
+		if err := nw.Upgrade(network.Upgrade{DeviceType: network.DeviceTypeDummy}); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	mgr, err := NewManager(root, false, WithGracePeriod(5*time.Second))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var lock sync.Mutex
+	var stopped []string
+	mgr.Events().Stopped.Subscribe(func(payload network.NetworkID) {
+		lock.Lock()
+		defer lock.Unlock()
+		stopped = append(stopped, payload.Name)
+	})
+	for _, name := range []string{"alfa", "beta"} {
+		if err := mgr.SetAutoStart(name, true); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if err := mgr.StartAutoStart(context.Background()); err != nil {
+		t.Error(err)
+		mgr.Shutdown()
+		return
+	}
+	if running := mgr.Running(); !reflect.DeepEqual(running, []string{"alfa", "beta"}) {
+		t.Error("unexpected running networks:", running)
+	}
+	instance, _ := mgr.Instance("alfa")
+	if again, err := mgr.Start(context.Background(), "alfa"); err != nil || again != instance {
+		t.Error("running instance should be returned as is:", err)
+	}
+
+	// interface of gamma is occupied by another (here pretended) network
+	gamma, err := mgr.Network("gamma")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	cfg, err := gamma.Read()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	occupied := &managedNetwork{iface: cfg.Interface, ready: make(chan struct{})}
+	close(occupied.ready)
+	mgr.lock.Lock()
+	mgr.networks["delta"] = occupied
+	mgr.lock.Unlock()
+	if _, err := mgr.Start(context.Background(), "gamma"); err == nil || !strings.Contains(err.Error(), "delta") {
+		t.Error("network with used interface should be rejected:", err)
+	}
+	mgr.lock.Lock()
+	delete(mgr.networks, "delta")
+	mgr.lock.Unlock()
+
+	// stop of starting network waits for start
+	starting := &managedNetwork{ready: make(chan struct{})}
+	mgr.lock.Lock()
+	mgr.networks["delta"] = starting
+	mgr.lock.Unlock()
+	stopDone := make(chan struct{})
+	go func() {
+		defer close(stopDone)
+		mgr.Stop("delta")
+	}()
+	select {
+	case <-stopDone:
+		t.Error("stop returned before network started")
+	case <-time.After(100 * time.Millisecond):
+	}
+	starting.err = errors.New("start failed")
+	close(starting.ready)
+	select {
+	case <-stopDone:
+	case <-time.After(time.Second):
+		t.Error("stop not returned after start")
+	}
+	mgr.lock.Lock()
+	delete(mgr.networks, "delta")
+	mgr.lock.Unlock()
+
+	mgr.Shutdown()
+	if len(mgr.Running()) != 0 {
+		t.Error("nothing should be running after shutdown")
+	}
+	// stop event is emitted right after exit
+	var events []string
+	for attempt := 0; attempt < 50 && len(events) < 2; attempt++ {
+		time.Sleep(20 * time.Millisecond)
+		lock.Lock()
+		events = append([]string{}, stopped...)
+		lock.Unlock()
+	}
+	sort.Strings(events)
+	if !reflect.DeepEqual(events, []string{"alfa", "beta"}) {
+		t.Error("stop events are not aggregated:", events)
+	}
+}
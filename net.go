@@ -2,13 +2,19 @@ package tincd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/tinc-boot/tincd/internal"
-	"github.com/tinc-boot/tincd/internal/api/impl/apiclient"
+	"github.com/tinc-boot/tincd/internal/api"
 	"github.com/tinc-boot/tincd/internal/api/impl/apiserver"
+	"github.com/tinc-boot/tincd/internal/dnsserver"
+	"github.com/tinc-boot/tincd/internal/netconf"
 	"github.com/tinc-boot/tincd/network"
 	"github.com/tinc-boot/tincd/runner"
+	"github.com/tinc-boot/tincd/userspace"
 	"log"
+	"net"
+	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -19,9 +25,21 @@ import (
 
 type netImpl struct {
 	tincBin     string
+	caps        runner.Capabilities
 	activePeers sync.Map
 	events      network.Events
 	definition  *network.Network
+	dnsAddress  string
+	pathMTU     sync.Map // node -> path MTU
+	stack       userspace.Stack
+	grace       time.Duration // time for tincd to stop gracefully before kill
+	logPolicy   runner.LogPolicy
+	logfile     *runner.LogFile
+
+	deadlineLock sync.Mutex
+	deadline     time.Time // optional deadline of stop, overrides grace period
+
+	configListeners runListeners // ConfigChanged handlers of running components
 
 	stop func()
 	done chan struct{}
@@ -50,15 +68,28 @@ func (impl *netImpl) initAndStart(global context.Context, withSudo bool) error {
 		interfaceName = config.Device[strings.LastIndex(config.Device, "/")+1:]
 	}
 
+	if config.Userspace() {
+		// no kernel device - no privileges required
+		withSudo = false
+	}
+
+	logfile, err := runner.OpenLog(filepath.Join(absDir, runner.LogFileName), impl.logPolicy)
+	if err != nil {
+		return err
+	}
+	impl.logfile = logfile
+
 	ctx, cancel := context.WithCancel(global)
 	impl.stop = cancel
 	impl.done = make(chan struct{})
 	go func() {
 		defer cancel()
+		defer logfile.Close()
 		defer impl.events.Stopped.Emit(network.NetworkID{Name: impl.definition.Name()})
 		defer close(impl.done)
-		impl.err = impl.run(absDir, withSudo, self, ctx)
+		impl.err = impl.run(absDir, interfaceName, withSudo, self, config, ctx)
 		impl.activePeers = sync.Map{}
+		impl.pathMTU = sync.Map{}
 	}()
 	return nil
 }
@@ -67,10 +98,25 @@ func (impl *netImpl) Events() *network.Events {
 	return &impl.events
 }
 
-func (impl *netImpl) Stop() {
+func (impl *netImpl) Stop(deadline ...time.Time) {
+	if len(deadline) > 0 {
+		impl.deadlineLock.Lock()
+		impl.deadline = deadline[0]
+		impl.deadlineLock.Unlock()
+	}
 	impl.stop()
 }
 
+// time given to tincd to stop gracefully: until deadline of Stop (if defined) or grace period
+func (impl *netImpl) gracePeriod() time.Duration {
+	impl.deadlineLock.Lock()
+	defer impl.deadlineLock.Unlock()
+	if !impl.deadline.IsZero() {
+		return time.Until(impl.deadline)
+	}
+	return impl.grace
+}
+
 func (impl *netImpl) Done() <-chan struct{} {
 	return impl.done
 }
@@ -79,6 +125,14 @@ func (impl *netImpl) Error() error {
 	return impl.err
 }
 
+func (impl *netImpl) Capabilities() runner.Capabilities {
+	return impl.caps
+}
+
+func (impl *netImpl) Logs(lines int) []string {
+	return impl.logfile.Tail(lines)
+}
+
 func (impl *netImpl) Peers() []string {
 	var ans []string
 	impl.activePeers.Range(func(key, value interface{}) bool {
@@ -89,6 +143,17 @@ func (impl *netImpl) Peers() []string {
 	return ans
 }
 
+func (impl *netImpl) PathMTU() map[string]int {
+	var ans = make(map[string]int)
+	impl.pathMTU.Range(func(key, value interface{}) bool {
+		if impl.IsActive(key.(string)) {
+			ans[key.(string)] = value.(int)
+		}
+		return true
+	})
+	return ans
+}
+
 func (impl *netImpl) IsActive(node string) bool {
 	_, ok := impl.activePeers.Load(node)
 	return ok
@@ -111,54 +176,167 @@ func (impl *netImpl) IsRunning() bool {
 	}
 }
 
-func (impl *netImpl) run(absDir string, withSudo bool, self *network.Node, global context.Context) error {
+func (impl *netImpl) run(absDir string, interfaceName string, withSudo bool, self *network.Node, config *network.Config, global context.Context) error {
 	ctx, abort := context.WithCancel(global)
 	defer abort()
 
 	var wg sync.WaitGroup
+	var failure error
+	var stopped *ErrTincExited // tincd stopped by user
+	var failOnce sync.Once
+	fail := func(err error) {
+		failOnce.Do(func() {
+			failure = err
+		})
+		abort()
+	}
+
+	// kill tincd if it is not stopped gracefully in time
+	kill, forceKill := context.WithCancel(context.Background())
+	defer forceKill()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-kill.Done():
+			return
+		}
+		timer := time.NewTimer(impl.gracePeriod())
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			log.Println(impl.definition.Name(), "tincd not stopped in time - killing")
+			forceKill()
+		case <-kill.Done():
+		}
+	}()
+
+	// subnets of joined and left nodes for native interface configuration
+	var subnets chan runner.SubnetEvent
+	native := config.NativeInterface && !config.Userspace()
+	if native {
+		subnets = make(chan runner.SubnetEvent, 128)
+	}
 
 	// run tinc service
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		defer abort()
+		defer forceKill()
 
-		for event := range runner.RunTinc(global, withSudo, impl.tincBin, absDir) {
-			if event.Add {
-				impl.activePeers.Store(event.Peer.Node, event)
+		proc, err := runner.RunTinc(ctx, kill, withSudo, impl.tincBin, absDir, impl.logfile)
+		if err != nil {
+			fail(err)
+			return
+		}
+		for event := range proc.Events() {
+			if pmtu := event.PathMTU; pmtu != nil {
+				impl.pathMTU.Store(pmtu.Node, pmtu.PMTU)
+				continue
+			}
+			if event.Subnet.Add {
+				impl.activePeers.Store(event.Subnet.Peer.Node, event.Subnet)
 			} else {
-				impl.activePeers.Delete(event.Peer.Node)
+				impl.activePeers.Delete(event.Subnet.Peer.Node)
+				impl.pathMTU.Delete(event.Subnet.Peer.Node)
+			}
+			log.Printf("%+v", *event.Subnet)
+			if subnets != nil {
+				select {
+				case subnets <- *event.Subnet:
+				case <-ctx.Done():
+				}
 			}
-			log.Printf("%+v", event)
 		}
-
+		var startErr *runner.StartError
+		if errors.As(proc.Err(), &startErr) {
+			fail(startErr)
+			return
+		}
+		exit := newExitError(proc.Err(), global.Err() != nil, impl.logfile.Tail(ExitLogLines))
+		if exit.Stopped {
+			stopped = exit
+		} else {
+			fail(exit)
+		}
 	}()
 
-	// run http API
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		defer abort()
-		server := &localApiServer{definition: impl.definition}
-		for {
-			err := apiserver.RunHTTP(ctx, "tcp", self.IP+":"+strconv.Itoa(CommunicationPort), server)
-			log.Println(impl.definition.Name(), "api stopped:", err)
-			select {
-			case <-ctx.Done():
-				return
-			case <-time.After(time.Second):
-				log.Println("trying again...")
+	// terminate userspace device by stack
+	if config.DeviceType == network.DeviceTypeMulticast && impl.stack != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := impl.serveStack(ctx, config, self); err != nil {
+				fail(fmt.Errorf("userspace stack: %w", err))
 			}
-		}
-	}()
+		}()
+	}
 
+	if config.Userspace() && impl.stack == nil {
+		log.Println(impl.definition.Name(), "userspace mode without stack: node will only relay traffic")
+	} else {
+		// run http API
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer abort()
+			server := &localApiServer{definition: impl.definition}
+			for {
+				err := impl.serveAPI(ctx, server)
+				log.Println(impl.definition.Name(), "api stopped:", err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Second):
+					log.Println("trying again...")
+				}
+			}
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := impl.greetEveryone(ctx, *self, GreetInterval)
+			if err != nil {
+				log.Println("greeting failed:", err)
+			}
+		}()
+	}
+
+	// configure interface instead of scripts
+	if native {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := impl.configureInterface(ctx, interfaceName, subnets); err != nil {
+				fail(fmt.Errorf("configure interface: %w", err))
+			}
+		}()
+	}
+
+	// refresh discovered path MTU
+	if impl.caps.NodesDump {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			impl.dumpNodes(ctx, PathMTUInterval)
+		}()
+	}
+
+	// resolve node names
+	if impl.dnsAddress != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			impl.runDNS(ctx)
+		}()
+	}
+
+	// reload tincd after changes in hosts
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		err := impl.greetEveryone(ctx, *self, GreetInterval)
-		if err != nil {
-			log.Println("greeting failed:", err)
-		}
+		impl.reloadOnChanges(ctx, *self)
 	}()
 
 	// fix: change owner of log file and pid file to process runner
@@ -174,9 +352,283 @@ func (impl *netImpl) run(absDir string, withSudo bool, self *network.Node, globa
 
 	impl.activePeers.Store(self.Name, self)
 	wg.Wait()
+	if failure != nil {
+		return failure
+	}
+	if stopped != nil {
+		return stopped
+	}
 	return ctx.Err()
 }
 
+// serve tinc-boot API on VPN address of self node
+func (impl *netImpl) serveAPI(ctx context.Context, server api.API) error {
+	listener, err := impl.Listen(CommunicationPort)
+	if err != nil {
+		return err
+	}
+	return apiserver.ServeHTTP(ctx, listener, server)
+}
+
+// periodically ask tincd to dump nodes: path MTU is parsed from the dump. Failures (ex: tincd not yet started or
+// restarting) are logged once until the next success.
+func (impl *netImpl) dumpNodes(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var failed bool
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := runner.DumpNodes(impl.definition.Pidfile())
+			if err != nil && !failed {
+				log.Println(impl.definition.Name(), "dump nodes:", err)
+			}
+			failed = err != nil
+		}
+	}
+}
+
+// apply addresses to interface after start (and after changes in configuration), add and remove routes to subnets
+// of other nodes when they join and leave (as subnet-up and subnet-down scripts do). Interface is reset (routes and
+// addresses removed, interface down) on stop. Requires CAP_NET_ADMIN for the current process: privileges of tincd
+// started with sudo or by helper are not enough.
+func (impl *netImpl) configureInterface(ctx context.Context, name string, subnets <-chan runner.SubnetEvent) error {
+	var settings = netconf.Settings{Name: name}
+	apply := func() error {
+		self, config, err := impl.definition.SelfConfig()
+		if err != nil {
+			return err
+		}
+		settings.MTU = config.MTU
+		settings.Addresses = config.InterfaceAddresses(self)
+		return netconf.Apply(ctx, settings)
+	}
+	if err := apply(); err != nil {
+		return privilegedError(err)
+	}
+	routes := newRouteTable()
+	defer func() {
+		settings.Routes = routes.list()
+		if err := netconf.Reset(settings); err != nil {
+			log.Println(impl.definition.Name(), "reset interface:", err)
+		}
+	}()
+	changed := make(chan struct{}, 1)
+	defer impl.onConfigChanged(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+			if err := apply(); err != nil {
+				log.Println(impl.definition.Name(), "re-configure interface:", err)
+			}
+		case event := <-subnets:
+			if err := impl.updateRoute(name, routes, event); err != nil {
+				log.Println(impl.definition.Name(), "update route:", err)
+			}
+		}
+	}
+}
+
+// add route after first node advertised subnet and remove it after last one
+func (impl *netImpl) updateRoute(name string, routes *routeTable, event runner.SubnetEvent) error {
+	config, err := impl.definition.Read()
+	if err != nil {
+		return err
+	}
+	subnet := config.RouteTo(event.Peer.Node, event.Peer.Subnet)
+	if subnet == nil {
+		return nil
+	}
+	if event.Add {
+		if routes.add(event.Peer.Node, subnet) {
+			return netconf.AddRoute(name, subnet)
+		}
+		return nil
+	}
+	if routes.remove(event.Peer.Node, subnet) {
+		return netconf.RemoveRoutes(name, []*net.IPNet{subnet})
+	}
+	return nil
+}
+
+// netlink operations are denied without CAP_NET_ADMIN
+func privilegedError(err error) error {
+	if errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("%w: native interface configuration requires CAP_NET_ADMIN (run as root): %v", runner.ErrPermissionDenied, err)
+	}
+	return err
+}
+
+// routed subnets and nodes which advertise them
+type routeTable struct {
+	owners map[string]map[string]bool // subnet -> nodes
+	nets   map[string]*net.IPNet
+}
+
+func newRouteTable() *routeTable {
+	return &routeTable{owners: make(map[string]map[string]bool), nets: make(map[string]*net.IPNet)}
+}
+
+// register subnet of node, returns true if subnet was not routed before
+func (rt *routeTable) add(node string, subnet *net.IPNet) bool {
+	key := subnet.String()
+	nodes, ok := rt.owners[key]
+	if !ok {
+		nodes = make(map[string]bool)
+		rt.owners[key] = nodes
+		rt.nets[key] = subnet
+	}
+	nodes[node] = true
+	return !ok
+}
+
+// unregister subnet of node, returns true if subnet is not advertised by other nodes anymore
+func (rt *routeTable) remove(node string, subnet *net.IPNet) bool {
+	key := subnet.String()
+	nodes, ok := rt.owners[key]
+	if !ok {
+		return false
+	}
+	delete(nodes, node)
+	if len(nodes) > 0 {
+		return false
+	}
+	delete(rt.owners, key)
+	delete(rt.nets, key)
+	return true
+}
+
+// all routed subnets
+func (rt *routeTable) list() []*net.IPNet {
+	var ans = make([]*net.IPNet, 0, len(rt.nets))
+	for _, subnet := range rt.nets {
+		ans = append(ans, subnet)
+	}
+	return ans
+}
+
+func (impl *netImpl) runDNS(ctx context.Context) {
+	server := dnsserver.New(impl.definition.Name())
+	refresh := func() {
+		nodes, err := impl.definition.NodesDefinitions()
+		if err != nil {
+			log.Println(impl.definition.Name(), "dns: list nodes:", err)
+			return
+		}
+		server.Update(nodes)
+	}
+	refresh()
+	defer impl.onConfigChanged(refresh)()
+	for {
+		err := server.Run(ctx, impl.dnsAddress)
+		log.Println(impl.definition.Name(), "dns stopped:", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+			log.Println("trying again...")
+		}
+	}
+}
+
+// subscribe handler to ConfigChanged until returned function is called
+func (impl *netImpl) onConfigChanged(handler func()) (unsubscribe func()) {
+	listeners := &impl.configListeners
+	listeners.once.Do(func() {
+		impl.events.ConfigChanged.Subscribe(func(network.NetworkID) {
+			listeners.notify()
+		})
+	})
+	return listeners.add(handler)
+}
+
+// handlers scoped to single run of a component. Generated events bus does not support unsubscribe, so the bus
+// has only one subscription per instance which dispatches to current handlers
+type runListeners struct {
+	once     sync.Once
+	lock     sync.Mutex
+	next     int
+	handlers map[int]func()
+}
+
+func (rl *runListeners) add(handler func()) (remove func()) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	if rl.handlers == nil {
+		rl.handlers = make(map[int]func())
+	}
+	id := rl.next
+	rl.next++
+	rl.handlers[id] = handler
+	return func() {
+		rl.lock.Lock()
+		defer rl.lock.Unlock()
+		delete(rl.handlers, id)
+	}
+}
+
+func (rl *runListeners) notify() {
+	rl.lock.Lock()
+	var handlers = make([]func(), 0, len(rl.handlers))
+	for _, handler := range rl.handlers {
+		handlers = append(handlers, handler)
+	}
+	rl.lock.Unlock()
+	for _, handler := range handlers {
+		handler()
+	}
+}
+
+func (rl *runListeners) len() int {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	return len(rl.handlers)
+}
+
+func (impl *netImpl) reloadOnChanges(ctx context.Context, self network.Node) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	changes, err := impl.definition.WatchHosts(ctx)
+	if err != nil {
+		log.Println(impl.definition.Name(), "watch hosts:", err)
+		return
+	}
+	for range changes {
+		if updated, err := impl.definition.Self(); err == nil && updated.Version > self.Version {
+			// self definition changed (ex: ReassignIP) - announce it
+			self = *updated
+			wg.Add(1)
+			go func(self network.Node) {
+				defer wg.Done()
+				if err := impl.greetEveryone(ctx, self, GreetInterval); err != nil {
+					log.Println("greeting failed:", err)
+				}
+			}(self)
+		}
+		if err := impl.definition.IndexPublicNodes(); err != nil {
+			log.Println(impl.definition.Name(), "index public nodes:", err)
+			continue
+		}
+		if err := impl.definition.UpdateHostsFiles(); err != nil {
+			log.Println(impl.definition.Name(), "update hosts files:", err)
+		}
+		if err := runner.Reload(impl.definition.Pidfile()); err != nil {
+			log.Println(impl.definition.Name(), "reload tincd:", err)
+			continue
+		}
+		impl.events.ConfigChanged.Emit(network.NetworkID{Name: impl.definition.Name()})
+	}
+}
+
 func (impl *netImpl) greetEveryone(ctx context.Context, self network.Node, retryInterval time.Duration) error {
 	var wg sync.WaitGroup
 
@@ -186,7 +638,7 @@ func (impl *netImpl) greetEveryone(ctx context.Context, self network.Node, retry
 	}
 
 	for _, node := range nodes {
-		if node.IP == "" {
+		if node.PreferredIP() == "" {
 			log.Println("will not greet", node.Name, "'cause it is relay node")
 			continue
 		}
@@ -194,7 +646,7 @@ func (impl *netImpl) greetEveryone(ctx context.Context, self network.Node, retry
 		go func(node network.Node) {
 			defer wg.Done()
 
-			var client = apiclient.APIClient{BaseURL: "http://" + node.IP + ":" + strconv.Itoa(CommunicationPort)}
+			var client = impl.apiClient("http://" + net.JoinHostPort(node.PreferredIP(), strconv.Itoa(CommunicationPort)))
 			for {
 				toImport, err := client.Exchange(ctx, self)
 				if err != nil {
@@ -203,10 +655,13 @@ func (impl *netImpl) greetEveryone(ctx context.Context, self network.Node, retry
 				}
 				for _, node := range toImport {
 					err := impl.Definition().Put(&node)
-					if err != nil {
+					if err != nil && !errors.Is(err, network.ErrOutdatedVersion) {
 						log.Println(node.Name, "import", node.Name, ":", err)
 					}
 				}
+				if err := impl.Definition().Materialize(); err != nil {
+					log.Println("materialize imported nodes:", err)
+				}
 				log.Println("greeted", node.Name)
 				break
 			SLEEP:
@@ -230,8 +685,12 @@ type localApiServer struct {
 
 func (impl *localApiServer) Exchange(ctx context.Context, remote network.Node) ([]network.Node, error) {
 	err := impl.definition.Put(&remote)
-	if err != nil {
-		return nil, err
+	if err != nil && !errors.Is(err, network.ErrOutdatedVersion) {
+		// outdated node will get actual description from reply
+		return nil, toRPCError(err)
+	}
+	if err := impl.definition.Materialize(); err != nil {
+		log.Println("materialize imported node:", err)
 	}
 	return impl.definition.NodesDefinitions()
 }
@@ -0,0 +1,74 @@
+package tincd
+
+import (
+	"context"
+	"github.com/tinc-boot/tincd/network"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRouteTable(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+	routes := newRouteTable()
+	if !routes.add("alfa", subnet) {
+		t.Error("first advertisement should add route")
+	}
+	if routes.add("alfa", subnet) || routes.add("beta", subnet) {
+		t.Error("repeated advertisement should not add route")
+	}
+	if routes.remove("alfa", subnet) {
+		t.Error("route should be kept while other node advertises subnet")
+	}
+	if list := routes.list(); len(list) != 1 || list[0].String() != "192.168.1.0/24" {
+		t.Errorf("unexpected routes: %v", list)
+	}
+	if !routes.remove("beta", subnet) {
+		t.Error("route should be removed after last node left")
+	}
+	if routes.remove("beta", subnet) {
+		t.Error("unknown route removed")
+	}
+	if list := routes.list(); len(list) != 0 {
+		t.Errorf("unexpected routes: %v", list)
+	}
+}
+
+func TestNetImpl_runDNSUnsubscribe(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	ntw, err := Create(filepath.Join(tmp, "dns"), "10.10.0.0/16")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	impl := &netImpl{definition: ntw, dnsAddress: "127.0.0.1:0"}
+	// each run (as after restart) subscribes for changes and unsubscribes on exit
+	for run := 0; run < 3; run++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			impl.runDNS(ctx)
+		}()
+		for attempt := 0; attempt < 50 && impl.configListeners.len() == 0; attempt++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if n := impl.configListeners.len(); n != 1 {
+			t.Errorf("run %d: expected one subscriber, got %d", run, n)
+		}
+		impl.events.ConfigChanged.Emit(network.NetworkID{Name: ntw.Name()})
+		cancel()
+		<-done
+		if n := impl.configListeners.len(); n != 0 {
+			t.Errorf("run %d: subscriber left after exit: %d", run, n)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package network
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// File (in network directory) with settings used only by the library (AutoStart, Hook, NativeInterface, Network,
+// Network6, Mask6). It is not parsed by tincd, unlike tinc.conf and conf.d/*.conf
+const SettingsFile = "settings.conf"
+
+// keys of Config ignored by tincd and stored in SettingsFile
+var libraryKeys = map[string]bool{
+	"AutoStart":       true,
+	"Hook":            true,
+	"NativeInterface": true,
+	"Network":         true,
+	"Network6":        true,
+	"Mask6":           true,
+}
+
+// Read main configuration file (tinc.conf) and library settings (SettingsFile) from directory and merge
+// user-managed fragments from conf.d/*.conf (as tinc 1.1 does). Fragments are applied in lexical order after the
+// main file: scalar keys from a later source override earlier ones, list keys (like ConnectTo) are accumulated.
+// Origin of each key is available by Config.Source.
+func ConfigFromDir(dir string) (*Config, error) {
+	mainFile := filepath.Join(dir, "tinc.conf")
+	cfg, err := ConfigFromFile(mainFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg.sources = make(map[string]string)
+	cfg.overrides = &Config{}
+	for _, key := range cfg.definedKeys() {
+		cfg.sources[key] = mainFile
+	}
+
+	// library settings of previous versions were kept in tinc.conf
+	settingsFile := filepath.Join(dir, SettingsFile)
+	settings, err := ConfigFromFile(settingsFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("settings: %w", err)
+	} else if err == nil {
+		cfg.merge(settings, settingsFile, false)
+	}
+
+	fragments, err := listFragments(filepath.Join(dir, "conf.d"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range fragments {
+		fragment, err := ConfigFromFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("fragment %s: %w", file, err)
+		}
+		cfg.merge(fragment, file, true)
+	}
+	return cfg, nil
+}
+
+// Source file which provided value for key (case-insensitive). Empty if key is not defined or configuration
+// was not read from disk.
+func (cfg *Config) Source(key string) string {
+	for name, file := range cfg.sources {
+		if strings.EqualFold(name, key) {
+			return file
+		}
+	}
+	return ""
+}
+
+// merge fragment into config: scalars replaced, lists accumulated. Values of user fragment are also remembered as
+// user-managed, so they will not be written back to the main file.
+func (cfg *Config) merge(fragment *Config, file string, user bool) {
+	target := reflect.ValueOf(cfg).Elem()
+	overrides := reflect.ValueOf(cfg.overrides).Elem()
+	source := reflect.ValueOf(fragment).Elem()
+	for _, i := range configFields() {
+		value := source.Field(i)
+		if value.IsZero() {
+			continue
+		}
+		if value.Kind() == reflect.Slice {
+			target.Field(i).Set(reflect.AppendSlice(target.Field(i), value))
+			if user {
+				overrides.Field(i).Set(reflect.AppendSlice(overrides.Field(i), value))
+			}
+		} else {
+			target.Field(i).Set(value)
+			if user {
+				overrides.Field(i).Set(value)
+			}
+		}
+		cfg.sources[target.Type().Field(i).Name] = file
+	}
+}
+
+// copy of config without values provided by user-managed fragments. Returns ErrOverridden if scalar key defined by
+// fragment was changed: the change would be shadowed by the fragment.
+func (cfg *Config) managed() (*Config, error) {
+	cp := *cfg
+	if cfg.overrides == nil {
+		return &cp, nil
+	}
+	target := reflect.ValueOf(&cp).Elem()
+	user := reflect.ValueOf(cfg.overrides).Elem()
+	for _, i := range configFields() {
+		value := user.Field(i)
+		if value.IsZero() {
+			continue
+		}
+		field := target.Field(i)
+		if value.Kind() != reflect.Slice {
+			if !reflect.DeepEqual(field.Interface(), value.Interface()) {
+				name := target.Type().Field(i).Name
+				return nil, fmt.Errorf("%w: %s is defined in %s", ErrOverridden, name, cfg.Source(name))
+			}
+			field.Set(reflect.Zero(field.Type()))
+			continue
+		}
+		filtered := reflect.MakeSlice(field.Type(), 0, field.Len())
+		for j := 0; j < field.Len(); j++ {
+			if !containsValue(value, field.Index(j)) {
+				filtered = reflect.Append(filtered, field.Index(j))
+			}
+		}
+		field.Set(filtered)
+	}
+	return &cp, nil
+}
+
+// split config to keys for tincd (tinc.conf) and library settings (SettingsFile)
+func (cfg *Config) split() (tinc *Config, library *Config) {
+	tinc, library = &Config{}, &Config{}
+	source := reflect.ValueOf(cfg).Elem()
+	for _, i := range configFields() {
+		target := tinc
+		if libraryKeys[source.Type().Field(i).Name] {
+			target = library
+		}
+		reflect.ValueOf(target).Elem().Field(i).Set(source.Field(i))
+	}
+	return tinc, library
+}
+
+func (cfg *Config) definedKeys() []string {
+	value := reflect.ValueOf(cfg).Elem()
+	var ans []string
+	for _, i := range configFields() {
+		if !value.Field(i).IsZero() {
+			ans = append(ans, value.Type().Field(i).Name)
+		}
+	}
+	return ans
+}
+
+// indexes of exported (serializable) fields of Config
+func configFields() []int {
+	tp := reflect.TypeOf(Config{})
+	var ans []int
+	for i := 0; i < tp.NumField(); i++ {
+		if tp.Field(i).PkgPath == "" {
+			ans = append(ans, i)
+		}
+	}
+	return ans
+}
+
+func containsValue(list reflect.Value, item reflect.Value) bool {
+	for i := 0; i < list.Len(); i++ {
+		if reflect.DeepEqual(list.Index(i).Interface(), item.Interface()) {
+			return true
+		}
+	}
+	return false
+}
+
+func listFragments(dir string) ([]string, error) {
+	list, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ans []string
+	for _, item := range list {
+		if !item.IsDir() && strings.HasSuffix(item.Name(), ".conf") {
+			ans = append(ans, filepath.Join(dir, item.Name()))
+		}
+	}
+	return ans, nil
+}
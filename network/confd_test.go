@@ -0,0 +1,139 @@
+package network
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigFromDir(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+
+	ntw := &Network{Root: filepath.Join(tmp, "confd")}
+	err = ntw.Update(&Config{Name: "alfa", Port: 1655, Mode: "switch", ConnectTo: []string{"beta"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	fragments := filepath.Join(ntw.Root, "conf.d")
+	if err := os.MkdirAll(fragments, 0755); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := ioutil.WriteFile(filepath.Join(fragments, "10-port.conf"), []byte("Port = 1700\nConnectTo = gamma\n"), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := ioutil.WriteFile(filepath.Join(fragments, "20-port.conf"), []byte("Port = 1800\n"), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+
+	cfg, err := ntw.Read()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if cfg.Port != 1800 {
+		t.Errorf("expected port from last fragment, got %d", cfg.Port)
+	}
+	if strings.Join(cfg.ConnectTo, ",") != "beta,gamma" {
+		t.Errorf("expected accumulated ConnectTo, got %v", cfg.ConnectTo)
+	}
+	if filepath.Base(cfg.Source("port")) != "20-port.conf" {
+		t.Errorf("unexpected source of port: %s", cfg.Source("port"))
+	}
+	if filepath.Base(cfg.Source("Name")) != "tinc.conf" {
+		t.Errorf("unexpected source of name: %s", cfg.Source("Name"))
+	}
+
+	cfg.Mode = "router"
+	if err := ntw.Update(cfg); err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := ioutil.ReadFile(filepath.Join(ntw.Root, "tinc.conf"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	text := string(data)
+	if strings.Contains(text, "Port") || strings.Contains(text, "gamma") {
+		t.Errorf("user-managed keys written to tinc.conf:\n%s", text)
+	}
+	if !strings.Contains(text, "Mode = router") || !strings.Contains(text, "ConnectTo = beta") {
+		t.Errorf("managed keys not written to tinc.conf:\n%s", text)
+	}
+
+	cfg.Port = 1900
+	if err := ntw.Update(cfg); !errors.Is(err, ErrOverridden) {
+		t.Error("change of key overridden by fragment should fail:", err)
+	}
+}
+
+func TestConfigFromDir_settings(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+
+	// library settings of previous versions in tinc.conf
+	ntw := &Network{Root: filepath.Join(tmp, "settings")}
+	if err := os.MkdirAll(ntw.Root, 0755); err != nil {
+		t.Error(err)
+		return
+	}
+	legacy := "Name = alfa\nMode = router\nAutoStart = true\nNetwork = 10.20.0.0/16\n"
+	if err := ioutil.WriteFile(filepath.Join(ntw.Root, "tinc.conf"), []byte(legacy), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+	cfg, err := ntw.Read()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !cfg.AutoStart || cfg.Network != "10.20.0.0/16" {
+		t.Errorf("legacy settings not read: %+v", cfg)
+	}
+
+	cfg.Hook = "/usr/bin/hook"
+	if err := ntw.Update(cfg); err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := ioutil.ReadFile(filepath.Join(ntw.Root, "tinc.conf"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	text := string(data)
+	if strings.Contains(text, "AutoStart") || strings.Contains(text, "Hook") || strings.Contains(text, "Network") {
+		t.Errorf("library settings written to tinc.conf:\n%s", text)
+	}
+	if !strings.Contains(text, "Mode = router") {
+		t.Errorf("tincd keys not written to tinc.conf:\n%s", text)
+	}
+
+	cfg, err = ntw.Read()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !cfg.AutoStart || cfg.Hook != "/usr/bin/hook" || cfg.Network != "10.20.0.0/16" {
+		t.Errorf("settings not restored: %+v", cfg)
+	}
+	if filepath.Base(cfg.Source("Hook")) != SettingsFile {
+		t.Errorf("unexpected source of hook: %s", cfg.Source("Hook"))
+	}
+}
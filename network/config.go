@@ -3,21 +3,44 @@ package network
 import (
 	"fmt"
 	"github.com/tinc-boot/tincd/config"
+	"math/rand"
 	"strconv"
 	"strings"
 )
 
-// Main configuration for network (tinc.conf)
+// Main configuration for network (tinc.conf and library settings, see SettingsFile)
 type Config struct {
 	Name       string   `json:"name"`                 // self node name
 	Port       uint16   `json:"port"`                 // listening port
 	Interface  string   `json:"interface"`            // interface name (for Darwin should be empty)
-	Mode       string   `json:"mode"`                 // mode, should be switch always
-	Mask       int      `json:"mask"`                 // subnet mask size
+	Mode       string   `json:"mode"`                 // mode: switch (default) or router
+	Network    string   `json:"network,omitempty"`    // IPv4 subnet of whole network (same for all nodes)
+	Network6   string   `json:"network6,omitempty"`   // IPv6 subnet of whole network (same for all nodes)
+	Mask       int      `json:"mask"`                 // IPv4 subnet mask size
+	Mask6      int      `json:"mask6,omitempty"`      // IPv6 prefix length (for IPv6 or dual-stack networks)
 	DeviceType string   `json:"deviceType,omitempty"` // device type (tap for most)
 	Device     string   `json:"device,omitempty"`     // device name
 	ConnectTo  []string `json:"connectTo,omitempty"`  // list of public nodes (automatically index)
 	Broadcast  string   `json:"broadcast"`            // broadcast mode (mst)
+	AutoStart  bool     `json:"autostart,omitempty"`  // start network automatically (see tincd.Manager), ignored by tincd
+	// executable invoked by all scripts as `<Hook> tinc-hook <script>` with environment provided by tincd
+	// (see ReadScriptEvent), ignored by tincd
+	Hook string `json:"hook,omitempty"`
+	// configure interface (addresses, routes, up/down) by library instead of commands in scripts (Linux only),
+	// ignored by tincd. Requires CAP_NET_ADMIN for the library process (ex: root), privileges of tincd (and of
+	// privileged helper, see runner.StartHelper) are not used
+	NativeInterface bool `json:"nativeInterface,omitempty"`
+	// interface MTU (applied by tinc-up, 0 means OS default)
+	MTU int `json:"mtu,omitempty"`
+	// maximum path MTU used by tincd (0 means tincd default)
+	PMTU int `json:"pmtu,omitempty"`
+	// path MTU discovery: yes (tincd default) or no
+	PMTUDiscovery string `json:"pmtuDiscovery,omitempty"`
+	// clamp MSS of TCP packets to path MTU: yes (tincd default) or no
+	ClampMSS string `json:"clampMSS,omitempty"`
+
+	sources   map[string]string // key -> file which defined it
+	overrides *Config           // values defined by user-managed fragments (conf.d)
 }
 
 // Upgrade few parameters of self node. Empty parameters are ignored
@@ -25,6 +48,58 @@ type Upgrade struct {
 	Port    uint16    `json:"port,omitempty"`    // listening port
 	Address []Address `json:"address,omitempty"` // list of public addresses
 	Device  string    `json:"device,omitempty"`  // custom device name
+	// device type: tap (kernel device) or multicast/dummy (userspace mode)
+	DeviceType string   `json:"deviceType,omitempty"`
+	Mode       string   `json:"mode,omitempty"`    // routing mode (switch or router)
+	Subnets    []string `json:"subnets,omitempty"` // replace routed subnets (site-to-site, requires router mode)
+	MTU        int      `json:"mtu,omitempty"`     // interface MTU
+	PMTU       int      `json:"pmtu,omitempty"`    // maximum path MTU
+	// path MTU discovery (yes or no)
+	PMTUDiscovery string `json:"pmtuDiscovery,omitempty"`
+	// clamp MSS of TCP packets to path MTU (yes or no)
+	ClampMSS string `json:"clampMSS,omitempty"`
+}
+
+// Supported device types.
+//
+// Multicast device exchanges decrypted frames through multicast group on loopback: any local user could join the
+// group to read and inject VPN traffic, so it should be used only on hosts where all local users are trusted.
+const (
+	DeviceTypeTap       = "tap"       // kernel TAP device, requires privileges
+	DeviceTypeMulticast = "multicast" // ethernet frames over local multicast group (see userspace package)
+	DeviceTypeDummy     = "dummy"     // no device: node only relays traffic of other nodes
+)
+
+// Userspace mode: tincd does not create kernel device and could be run without privileges
+func (cfg *Config) Userspace() bool {
+	return cfg.DeviceType == DeviceTypeMulticast || cfg.DeviceType == DeviceTypeDummy
+}
+
+// Generate multicast device definition (<group> <port> <ttl>) in administratively-scoped range with random group
+// and port. Zero TTL keeps frames inside host, but not hides them from other local users
+func multicastDevice() string {
+	return fmt.Sprintf("239.255.%d.%d %d 0", 1+rand.Intn(254), 1+rand.Intn(254), 30000+rand.Intn(35535))
+}
+
+// Limits of MTU and PMTU
+const (
+	MinMTU = 576
+	MaxMTU = 65535
+)
+
+// check MTU related settings
+func (cfg *Config) checkMTU() error {
+	for name, value := range map[string]int{"MTU": cfg.MTU, "PMTU": cfg.PMTU} {
+		if value != 0 && (value < MinMTU || value > MaxMTU) {
+			return fmt.Errorf("%s %d is out of range %d-%d", name, value, MinMTU, MaxMTU)
+		}
+	}
+	for name, value := range map[string]string{"PMTUDiscovery": cfg.PMTUDiscovery, "ClampMSS": cfg.ClampMSS} {
+		if value != "" && value != "yes" && value != "no" {
+			return fmt.Errorf("%s should be yes or no, got %s", name, value)
+		}
+	}
+	return nil
 }
 
 // Public address
@@ -54,14 +129,45 @@ func (addr *Address) Scan(value string) error {
 // Node configuration (as in hosts directory)
 type Node struct {
 	Name      string    `json:"name"`                                 // node name
-	Subnet    string    `json:"subnet"`                               // subnet (should same for all nodes in network)
+	Subnet    string    `json:"subnet" tinc:"-"`                      // first advertised subnet: own VPN address (whole network CIDR for legacy nodes)
+	Subnets   []string  `json:"subnets,omitempty" tinc:"Subnet"`      // other advertised subnets: own IPv6 address and routed networks
 	Port      uint16    `json:"port"`                                 // optional listening port
-	IP        string    `json:"ip"`                                   // VPN ip
+	IP        string    `json:"ip"`                                   // VPN IPv4
+	IP6       string    `json:"ip6,omitempty"`                        // VPN IPv6
 	Address   []Address `json:"address,omitempty"`                    // list of public addresses
 	PublicKey string    `json:"publicKey" tinc:"RSA PUBLIC KEY,blob"` // public RSA key
 	Version   int       `json:"version"`                              // version. should be updated only by node-owner
 }
 
+// VPN address for communication with node: IPv4 if defined, otherwise IPv6. Empty for relay nodes
+func (n *Node) PreferredIP() string {
+	if n.IP != "" {
+		return n.IP
+	}
+	return n.IP6
+}
+
+// All advertised subnets (Subnet and Subnets), as Subnet lines of host file
+func (n *Node) AllSubnets() []string {
+	if n.Subnet == "" {
+		return append([]string(nil), n.Subnets...)
+	}
+	return append([]string{n.Subnet}, n.Subnets...)
+}
+
+// replace all advertised subnets: first goes to Subnet (understood by nodes of previous versions), others to Subnets
+func (n *Node) setSubnets(subnets []string) {
+	n.Subnet = ""
+	n.Subnets = nil
+	if len(subnets) == 0 {
+		return
+	}
+	n.Subnet = subnets[0]
+	if len(subnets) > 1 {
+		n.Subnets = append([]string(nil), subnets[1:]...)
+	}
+}
+
 func (cfg *Config) Build() (text []byte, err error) {
 	return config.Marshal(cfg)
 }
@@ -71,9 +177,15 @@ func (cfg *Config) Parse(text []byte) error {
 }
 
 func (n *Node) Build() (text []byte, err error) {
-	return config.Marshal(n)
+	cp := *n
+	cp.Subnets = n.AllSubnets()
+	return config.Marshal(&cp)
 }
 
 func (n *Node) Parse(data []byte) error {
-	return config.Unmarshal(data, n)
+	if err := config.Unmarshal(data, n); err != nil {
+		return err
+	}
+	n.setSubnets(n.Subnets)
+	return nil
 }
@@ -1,6 +1,10 @@
 package network
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -50,3 +54,46 @@ func Test_parse(t *testing.T) {
 	}
 	t.Logf("%+v", cfg)
 }
+
+func TestNetwork_UpgradeDeviceType(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+
+	ntw := &Network{Root: filepath.Join(tmp, "devices")}
+	if err := ntw.Update(&Config{Name: "alfa", Interface: "tincdevices", Network: "10.10.0.0/16", Mask: 16}); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := ntw.put(&Node{Name: "alfa", Subnet: "10.10.1.2/32", IP: "10.10.1.2", Version: 1}); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := ntw.Upgrade(Upgrade{DeviceType: DeviceTypeMulticast}); err != nil {
+		t.Error(err)
+		return
+	}
+	cfg, err := ntw.Read()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !cfg.Userspace() || !strings.HasPrefix(cfg.Device, "239.255.") {
+		t.Errorf("unexpected multicast device: %+v", cfg)
+	}
+	if err := ntw.Upgrade(Upgrade{DeviceType: DeviceTypeTap}); err != nil {
+		t.Error(err)
+		return
+	}
+	cfg, err = ntw.Read()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if cfg.Userspace() || strings.HasPrefix(cfg.Device, "239.255.") {
+		t.Errorf("multicast device kept after upgrade to tap: %+v", cfg)
+	}
+}
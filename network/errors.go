@@ -0,0 +1,16 @@
+package network
+
+import "errors"
+
+// Errors of network definition. Returned errors wrap them with details, so use errors.Is
+var (
+	ErrNotDefined       = errors.New("network is not defined")
+	ErrInvalidNodeName  = errors.New("invalid node name")
+	ErrInvalidName      = errors.New("invalid network name")
+	ErrSubnetMismatch   = errors.New("mismatch subnet")
+	ErrOutdatedVersion  = errors.New("outdated node version")
+	ErrEmptyPublicKey   = errors.New("empty public key")
+	ErrEmptySubnet      = errors.New("empty subnet") // Deprecated: nodes without VPN address (relays) are accepted
+	ErrAddressCollision = errors.New("address already used")
+	ErrOverridden       = errors.New("key is overridden by user fragment")
+)
@@ -3,6 +3,7 @@ package network
 //go:generate events-gen -p network -E Events -s -P -o events.go -e Emitter
 
 //event:"Stopped"
+//event:"ConfigChanged"
 type NetworkID struct {
 	Name string `json:"name"`
 }
@@ -20,6 +20,24 @@ func (ev *eventStopped) Emit(payload NetworkID) {
 	ev.lock.RUnlock()
 }
 
+type eventConfigChanged struct {
+	lock     sync.RWMutex
+	handlers []func(NetworkID)
+}
+
+func (ev *eventConfigChanged) Subscribe(handler func(NetworkID)) {
+	ev.lock.Lock()
+	ev.handlers = append(ev.handlers, handler)
+	ev.lock.Unlock()
+}
+func (ev *eventConfigChanged) Emit(payload NetworkID) {
+	ev.lock.RLock()
+	for _, handler := range ev.handlers {
+		handler(payload)
+	}
+	ev.lock.RUnlock()
+}
+
 type eventPeerDiscovered struct {
 	lock     sync.RWMutex
 	handlers []func(PeerID)
@@ -76,6 +94,7 @@ func (ev *eventPeerLeft) Emit(payload PeerID) {
 
 type Events struct {
 	Stopped        eventStopped
+	ConfigChanged  eventConfigChanged
 	PeerDiscovered eventPeerDiscovered
 	PeerJoined     eventPeerJoined
 	PeerLeft       eventPeerLeft
@@ -85,6 +104,9 @@ func (bus *Events) Sink(sink func(eventName string, payload interface{})) *Event
 	bus.Stopped.Subscribe(func(payload NetworkID) {
 		sink("Stopped", payload)
 	})
+	bus.ConfigChanged.Subscribe(func(payload NetworkID) {
+		sink("ConfigChanged", payload)
+	})
 	bus.PeerDiscovered.Subscribe(func(payload PeerID) {
 		sink("PeerDiscovered", payload)
 	})
@@ -107,6 +129,9 @@ type emitterEvents struct {
 func (emitter *emitterEvents) Stopped(payload NetworkID) {
 	emitter.events.Stopped.Emit(payload)
 }
+func (emitter *emitterEvents) ConfigChanged(payload NetworkID) {
+	emitter.events.ConfigChanged.Emit(payload)
+}
 func (emitter *emitterEvents) PeerDiscovered(payload PeerID) {
 	emitter.events.PeerDiscovered.Emit(payload)
 }
@@ -119,11 +144,13 @@ func (emitter *emitterEvents) PeerLeft(payload PeerID) {
 
 func (bus *Events) SubscribeAll(listener interface {
 	Stopped(payload NetworkID)
+	ConfigChanged(payload NetworkID)
 	PeerDiscovered(payload PeerID)
 	PeerJoined(payload PeerID)
 	PeerLeft(payload PeerID)
 }) {
 	bus.Stopped.Subscribe(listener.Stopped)
+	bus.ConfigChanged.Subscribe(listener.ConfigChanged)
 	bus.PeerDiscovered.Subscribe(listener.PeerDiscovered)
 	bus.PeerJoined.Subscribe(listener.PeerJoined)
 	bus.PeerLeft.Subscribe(listener.PeerLeft)
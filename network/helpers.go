@@ -2,6 +2,7 @@ package network
 
 import (
 	"io/ioutil"
+	"os"
 	"path/filepath"
 )
 
@@ -32,3 +33,45 @@ func List(directory string) ([]*Network, error) {
 	}
 	return ans, nil
 }
+
+// Write file atomically: content is written to temporary file in the same directory, synced to disk and renamed
+// over the target. Readers (like tincd on reload) never observe partially written file.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(filename)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op after successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// flush directory entry changes (rename) to disk. Best effort: not supported on all platforms
+func syncDir(dir string) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = f.Sync()
+	_ = f.Close()
+}
@@ -0,0 +1,110 @@
+package network
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// system hosts file is shared by all networks of the process
+var systemHostsLock sync.Mutex
+
+// Location of hosts-format file (peers.hosts) with VPN addresses of all known nodes as <node>.<network>
+func (network *Network) HostsFile() string {
+	return filepath.Join(network.Root, "peers.hosts")
+}
+
+// Re-generate hosts-format file (see HostsFile) and marked block in SystemHosts file (if defined).
+// Called automatically after changes in known nodes (failures are logged, but do not fail the changes).
+func (network *Network) UpdateHostsFiles() error {
+	nodes, err := network.NodesDefinitions()
+	if err != nil {
+		return err
+	}
+	var block bytes.Buffer
+	for _, node := range nodes {
+		for _, ip := range []string{node.IP, node.IP6} {
+			if ip != "" {
+				_, _ = fmt.Fprintf(&block, "%s\t%s.%s\n", ip, strings.ToLower(node.Name), network.Name())
+			}
+		}
+	}
+	if err := writeFileAtomic(network.HostsFile(), block.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := ApplyOwnerOfSudoUser(network.HostsFile()); err != nil {
+		return err
+	}
+	if network.SystemHosts == "" {
+		return nil
+	}
+	if err := replaceMarkedBlock(network.SystemHosts, "tinc "+network.Name(), block.Bytes()); err != nil {
+		return fmt.Errorf("update %s: %w", network.SystemHosts, err)
+	}
+	return nil
+}
+
+// hosts files are informational: failure (ex: no access to system hosts file) should not break changes of nodes
+func (network *Network) updateHostsFiles() {
+	if err := network.UpdateHostsFiles(); err != nil {
+		log.Println(network.Name(), "update hosts files:", err)
+	}
+}
+
+// replace (or append) content between markers in file. Other content is kept as-is. File is replaced atomically
+// (temporary file renamed over it) with the same permissions and owner. Bind-mounted file (ex: /etc/hosts in
+// containers) could not be replaced, so it is rewritten in place.
+func replaceMarkedBlock(filename string, marker string, content []byte) error {
+	systemHostsLock.Lock()
+	defer systemHostsLock.Unlock()
+	begin, end := "# BEGIN "+marker, "# END "+marker
+	original, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var out bytes.Buffer
+	var inside bool
+	for _, line := range strings.SplitAfter(string(original), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == begin:
+			inside = true
+		case trimmed == end:
+			inside = false
+		case !inside && line != "":
+			out.WriteString(line)
+		}
+	}
+	if out.Len() > 0 && !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+		out.WriteString("\n")
+	}
+	out.WriteString(begin + "\n")
+	out.Write(content)
+	out.WriteString(end + "\n")
+	if original != nil && bytes.Equal(original, out.Bytes()) {
+		return nil
+	}
+
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return writeFileAtomic(filename, out.Bytes(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(filename, out.Bytes(), info.Mode().Perm())
+	if errors.Is(err, syscall.EBUSY) {
+		return ioutil.WriteFile(filename, out.Bytes(), info.Mode().Perm())
+	}
+	if err != nil {
+		return err
+	}
+	return keepOwner(filename, info)
+}
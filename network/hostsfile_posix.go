@@ -0,0 +1,17 @@
+//+build linux darwin
+
+package network
+
+import (
+	"os"
+	"syscall"
+)
+
+// restore owner of replaced file
+func keepOwner(filename string, original os.FileInfo) error {
+	stat, ok := original.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return os.Chown(filename, int(stat.Uid), int(stat.Gid))
+}
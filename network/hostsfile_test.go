@@ -0,0 +1,120 @@
+package network
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func Test_replaceMarkedBlock(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	hosts := filepath.Join(tmp, "hosts")
+
+	// missing file is created
+	if err := replaceMarkedBlock(hosts, "tinc demo", []byte("10.0.0.1\talfa.demo\n")); err != nil {
+		t.Error(err)
+		return
+	}
+	assertFile(t, hosts, "# BEGIN tinc demo\n10.0.0.1\talfa.demo\n# END tinc demo\n")
+
+	// block is appended, other content is kept
+	if err := ioutil.WriteFile(hosts, []byte("127.0.0.1\tlocalhost"), 0600); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := replaceMarkedBlock(hosts, "tinc demo", []byte("10.0.0.1\talfa.demo\n")); err != nil {
+		t.Error(err)
+		return
+	}
+	assertFile(t, hosts, "127.0.0.1\tlocalhost\n# BEGIN tinc demo\n10.0.0.1\talfa.demo\n# END tinc demo\n")
+
+	// block is replaced, content around it and blocks of other networks are kept
+	if err := ioutil.WriteFile(hosts, []byte("127.0.0.1\tlocalhost\n"+
+		"# BEGIN tinc demo\n10.0.0.1\talfa.demo\n# END tinc demo\n"+
+		"# BEGIN tinc other\n10.1.0.1\talfa.other\n# END tinc other\n"+
+		"::1\tlocalhost\n"), 0600); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := os.Chmod(hosts, 0600); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := replaceMarkedBlock(hosts, "tinc demo", []byte("10.0.0.2\tbeta.demo\n")); err != nil {
+		t.Error(err)
+		return
+	}
+	assertFile(t, hosts, "127.0.0.1\tlocalhost\n"+
+		"# BEGIN tinc other\n10.1.0.1\talfa.other\n# END tinc other\n"+
+		"::1\tlocalhost\n"+
+		"# BEGIN tinc demo\n10.0.0.2\tbeta.demo\n# END tinc demo\n")
+
+	// file is replaced atomically with the same permissions
+	after, err := os.Stat(hosts)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if after.Mode().Perm() != 0600 {
+		t.Errorf("permissions changed to %v", after.Mode().Perm())
+	}
+	if list, err := ioutil.ReadDir(tmp); err != nil || len(list) != 1 {
+		t.Errorf("temporary files left: %v (%v)", list, err)
+	}
+}
+
+func Test_replaceMarkedBlockConcurrent(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	hosts := filepath.Join(tmp, "hosts")
+
+	// networks of one process share system hosts file
+	var wg sync.WaitGroup
+	for _, name := range []string{"alfa", "beta", "gamma"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if err := replaceMarkedBlock(hosts, "tinc "+name, []byte("10.0.0.1\tnode."+name+"\n")); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(name)
+	}
+	wg.Wait()
+	data, err := ioutil.ReadFile(hosts)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, name := range []string{"alfa", "beta", "gamma"} {
+		if !strings.Contains(string(data), "# BEGIN tinc "+name+"\n10.0.0.1\tnode."+name+"\n# END tinc "+name+"\n") {
+			t.Errorf("block of %s lost:\n%s", name, data)
+		}
+	}
+}
+
+func assertFile(t *testing.T, filename string, expected string) {
+	t.Helper()
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(data) != expected {
+		t.Errorf("unexpected content of %s:\n%s\nexpected:\n%s", filename, data, expected)
+	}
+}
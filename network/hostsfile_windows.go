@@ -0,0 +1,6 @@
+package network
+
+import "os"
+
+// replaced file inherits access rules of directory
+func keepOwner(filename string, original os.FileInfo) error { return nil }
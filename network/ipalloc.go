@@ -0,0 +1,164 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+)
+
+const allocateAttempts = 64
+
+// Pick random free address in IPv4 or IPv6 subnet
+func allocateIP(subnet *net.IPNet, used []net.IP) (net.IP, error) {
+	if subnet.IP.To4() != nil {
+		return allocateIPv4(subnet, used)
+	}
+	return allocateIPv6(subnet, used)
+}
+
+// Pick random free IPv4 address in subnet. Network and broadcast addresses are reserved (except /31 and /32 subnets),
+// as well as addresses in used list.
+func allocateIPv4(subnet *net.IPNet, used []net.IP) (net.IP, error) {
+	base := subnet.IP.To4()
+	netsize, bits := subnet.Mask.Size()
+	if base == nil || bits != 32 {
+		return nil, fmt.Errorf("%s is not IPv4 subnet", subnet)
+	}
+	var busy = make(map[uint32]bool, len(used))
+	for _, ip := range used {
+		if v4 := ip.To4(); v4 != nil && subnet.Contains(v4) {
+			busy[binary.BigEndian.Uint32(v4)] = true
+		}
+	}
+	baseIP := binary.BigEndian.Uint32(base)
+	size := uint64(1) << uint(bits-netsize)
+	first, last := uint64(0), size-1
+	if size > 2 {
+		first, last = 1, size-2 // skip network and broadcast
+	}
+	free := last - first + 1
+	// random probes are enough for sparse subnets, full scan guarantees result for dense
+	for i := 0; i < allocateAttempts; i++ {
+		candidate := baseIP + uint32(first+uint64(rand.Int63n(int64(free))))
+		if !busy[candidate] {
+			return uint32ToIP(candidate), nil
+		}
+	}
+	for offset := first; offset <= last; offset++ {
+		if candidate := baseIP + uint32(offset); !busy[candidate] {
+			return uint32ToIP(candidate), nil
+		}
+	}
+	return nil, fmt.Errorf("no free addresses left in %s", subnet)
+}
+
+// Pick random free IPv6 address in prefix. Subnet-router anycast (all-zero host part) address is reserved,
+// as well as addresses in used list.
+func allocateIPv6(subnet *net.IPNet, used []net.IP) (net.IP, error) {
+	netsize, bits := subnet.Mask.Size()
+	if bits != 128 {
+		return nil, fmt.Errorf("%s is not IPv6 subnet", subnet)
+	}
+	if netsize > 126 {
+		return nil, fmt.Errorf("IPv6 prefix %s is too small", subnet)
+	}
+	var busy = make(map[string]bool, len(used))
+	for _, ip := range used {
+		busy[ip.To16().String()] = true
+	}
+	prefix := subnet.IP.To16()
+	for i := 0; i < allocateAttempts; i++ {
+		candidate := make(net.IP, net.IPv6len)
+		_, _ = rand.Read(candidate)
+		for j := range candidate {
+			candidate[j] = prefix[j] | (candidate[j] &^ subnet.Mask[j])
+		}
+		if !candidate.Equal(prefix) && !busy[candidate.String()] {
+			return candidate, nil
+		}
+	}
+	return nil, fmt.Errorf("no free addresses found in %s", subnet)
+}
+
+func uint32ToIP(value uint32) net.IP {
+	var ip [4]byte
+	binary.BigEndian.PutUint32(ip[:], value)
+	return net.IP(ip[:])
+}
+
+// VPN addresses of all known nodes except one (by name)
+func (network *Network) usedIPs(except string) ([]net.IP, error) {
+	nodes, err := network.NodesDefinitions()
+	if err != nil {
+		return nil, err
+	}
+	var ans []net.IP
+	for _, node := range nodes {
+		if node.Name == except {
+			continue
+		}
+		if ip := net.ParseIP(node.IP); ip != nil {
+			ans = append(ans, ip)
+		}
+		if ip := net.ParseIP(node.IP6); ip != nil {
+			ans = append(ans, ip)
+		}
+	}
+	return ans, nil
+}
+
+// find known node (except one by name) which uses the same VPN address (IPv4 or IPv6). Returns name of the node
+// and conflicting address
+func (network *Network) conflictingNode(node *Node) (string, net.IP, error) {
+	var addresses []net.IP
+	for _, addr := range []string{node.IP, node.IP6} {
+		if addr == "" {
+			continue
+		}
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return "", nil, fmt.Errorf("invalid IP %s of node %s", addr, node.Name)
+		}
+		addresses = append(addresses, ip)
+	}
+	if len(addresses) == 0 {
+		return "", nil, nil
+	}
+	nodes, err := network.NodesDefinitions()
+	if err != nil {
+		return "", nil, err
+	}
+	for _, other := range nodes {
+		if other.Name == node.Name {
+			continue
+		}
+		for _, ip := range addresses {
+			if ip.Equal(net.ParseIP(other.IP)) || ip.Equal(net.ParseIP(other.IP6)) {
+				return other.Name, ip, nil
+			}
+		}
+	}
+	return "", nil, nil
+}
+
+// split subnets to single IPv4 and single IPv6 subnet (each one is optional, but at least one required)
+func splitSubnets(subnets []*net.IPNet) (ipv4, ipv6 *net.IPNet, err error) {
+	for _, subnet := range subnets {
+		_, bits := subnet.Mask.Size()
+		switch {
+		case bits == 32 && ipv4 == nil:
+			ipv4 = subnet
+		case bits == 128 && ipv6 == nil:
+			ipv6 = subnet
+		case bits == 32 || bits == 128:
+			return nil, nil, fmt.Errorf("only one subnet per address family supported, but %s is extra", subnet)
+		default:
+			return nil, nil, fmt.Errorf("unsupported subnet %s", subnet)
+		}
+	}
+	if ipv4 == nil && ipv6 == nil {
+		return nil, nil, fmt.Errorf("at least one subnet required")
+	}
+	return ipv4, ipv6, nil
+}
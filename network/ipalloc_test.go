@@ -0,0 +1,92 @@
+package network
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_allocateIPv4(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/30")
+	// only .1 and .2 are usable
+	ip, err := allocateIPv4(subnet, []net.IP{net.ParseIP("10.0.0.1")})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if ip.String() != "10.0.0.2" {
+		t.Errorf("expected 10.0.0.2, got %s", ip)
+	}
+	_, err = allocateIPv4(subnet, []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")})
+	if err == nil {
+		t.Error("expected exhausted subnet")
+	}
+
+	_, subnet, _ = net.ParseCIDR("192.168.1.0/24")
+	var used []net.IP
+	for i := 0; i < 253; i++ {
+		ip, err := allocateIPv4(subnet, used)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if last := ip.To4()[3]; last == 0 || last == 255 {
+			t.Errorf("reserved address allocated: %s", ip)
+		}
+		for _, u := range used {
+			if u.Equal(ip) {
+				t.Errorf("duplicated address allocated: %s", ip)
+			}
+		}
+		used = append(used, ip)
+	}
+}
+
+func Test_allocateIPv6(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("fd00:1234::/64")
+	ip, err := allocateIP(subnet, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !subnet.Contains(ip) || ip.Equal(subnet.IP) {
+		t.Errorf("invalid address allocated: %s", ip)
+	}
+}
+
+func TestNetwork_PutCollision(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+
+	ntw := &Network{Root: filepath.Join(tmp, "collision")}
+	err = ntw.Update(&Config{Name: "alfa", Mode: ModeSwitch, Network: "10.10.0.0/16", Mask: 16, Network6: "fd00:10::/64", Mask6: 64})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := ntw.put(&Node{Name: "alfa", IP: "10.10.1.1", IP6: "fd00:10::1", Version: 1}); err != nil {
+		t.Error(err)
+		return
+	}
+	err = ntw.Put(&Node{Name: "beta", IP: "10.10.1.2", IP6: "fd00:10::2", PublicKey: fakePublicKey, Version: 1})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = ntw.Put(&Node{Name: "gamma", IP: "10.10.1.3", IP6: "fd00:10::2", PublicKey: fakePublicKey, Version: 1})
+	if !errors.Is(err, ErrAddressCollision) || !strings.Contains(err.Error(), "fd00:10::2") {
+		t.Error("IPv6 collision should be reported:", err)
+	}
+	// relay node without VPN addresses
+	if err := ntw.Put(&Node{Name: "delta", PublicKey: fakePublicKey, Version: 1}); err != nil {
+		t.Error("relay node should be accepted:", err)
+	}
+}
@@ -0,0 +1,56 @@
+package network
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Exclusively lock network directory against concurrent modifications from this and other processes.
+// Lock is advisory (flock/LockFileEx on lock file in root directory) and is not reentrant.
+func (network *Network) acquire() (unlock func(), err error) {
+	network.lock.Lock()
+	defer func() {
+		if err != nil {
+			network.lock.Unlock()
+		}
+	}()
+	if err := os.MkdirAll(network.Root, 0755); err != nil {
+		return nil, err
+	}
+	f, err := openLockFile(network.lockFile())
+	if err != nil {
+		return nil, fmt.Errorf("%s: open lock file: %w", network.Name(), err)
+	}
+	if err := lockFile(f); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s: lock: %w", network.Name(), err)
+	}
+	return func() {
+		_ = unlockFile(f)
+		_ = f.Close()
+		network.lock.Unlock()
+	}, nil
+}
+
+func (network *Network) lockFile() string {
+	return filepath.Join(network.Root, ".lock")
+}
+
+// open lock file for reading (flock and LockFileEx do not require write access), so lock file created by another
+// user (ex: root) does not block modifications. New lock file is owned by SUDO user (if applicable)
+func openLockFile(file string) (*os.File, error) {
+	f, err := os.Open(file)
+	if !os.IsNotExist(err) {
+		return f, err
+	}
+	f, err = os.OpenFile(file, os.O_CREATE|os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := ApplyOwnerOfSudoUser(file); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,76 @@
+package network
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNetwork_acquire(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	// separate instances (as in different processes) share only lock file
+	first := &Network{Root: filepath.Join(tmp, "lock")}
+	second := &Network{Root: first.Root}
+
+	unlock, err := first.acquire()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	acquired := make(chan struct{})
+	go func() {
+		unlock, err := second.acquire()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		unlock()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Error("lock acquired twice")
+	case <-time.After(200 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Error("lock not released")
+	}
+}
+
+func TestNetwork_acquireReadOnly(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	ntw := &Network{Root: filepath.Join(tmp, "lock")}
+	if err := os.MkdirAll(ntw.Root, 0755); err != nil {
+		t.Error(err)
+		return
+	}
+	// lock file left by another user (ex: root under sudo)
+	if err := ioutil.WriteFile(ntw.lockFile(), nil, 0444); err != nil {
+		t.Error(err)
+		return
+	}
+	unlock, err := ntw.acquire()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	unlock()
+	if err := ntw.Update(&Config{Name: "alfa", Mode: "switch"}); err != nil {
+		t.Error(err)
+	}
+}
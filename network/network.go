@@ -5,15 +5,14 @@ import (
 	crypto_rand "crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
-	"encoding/binary"
 	"encoding/pem"
 	"fmt"
 	"github.com/tinc-boot/tincd/utils"
-	"io/ioutil"
 	"math/rand"
 	"net"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 	"sync"
@@ -22,8 +21,11 @@ import (
 
 // Single network configuration
 type Network struct {
-	Root string // Root directory (preferred to be an absolute location), base name is network name
-	lock sync.Mutex
+	Root  string // Root directory (preferred to be an absolute location), base name is network name
+	Store Store  // Optional storage of definition. If not set, tinc layout in Root directory is used
+	// Optional hosts file (ex: /etc/hosts) where marked block with known nodes addresses will be maintained
+	SystemHosts string
+	lock        sync.Mutex
 }
 
 // Network name (base name of location)
@@ -31,49 +33,28 @@ func (network *Network) Name() string {
 	return filepath.Base(network.Root)
 }
 
-// Update network configuration (tinc.conf). Changes owner of file to SUDO user (if applicable)
+// Update network configuration (for default storage: tinc.conf, see DirStore.WriteConfig)
 func (network *Network) Update(config *Config) error {
-	err := os.MkdirAll(network.hosts(), 0755)
+	unlock, err := network.acquire()
 	if err != nil {
 		return err
 	}
-	err = ApplyOwnerOfSudoUser(network.hosts())
-	if err != nil {
-		return err
-	}
-	err = ApplyOwnerOfSudoUser(network.Root)
-	if err != nil {
-		return err
-	}
-	data, err := config.Build()
-	if err != nil {
-		return err
-	}
-	err = ioutil.WriteFile(network.configFile(), data, 0755)
-	if err != nil {
-		return err
-	}
-	return ApplyOwnerOfSudoUser(network.configFile())
+	defer unlock()
+	return network.update(config)
 }
 
-// Read network configuration (tinc.conf)
+func (network *Network) update(config *Config) error {
+	return network.store().WriteConfig(config)
+}
+
+// Read network configuration (for default storage: tinc.conf merged with conf.d/*.conf fragments)
 func (network *Network) Read() (*Config, error) {
-	return ConfigFromFile(network.configFile())
+	return network.store().ReadConfig()
 }
 
 // List known nodes names
 func (network *Network) Nodes() ([]string, error) {
-	list, err := ioutil.ReadDir(network.hosts())
-	if err != nil {
-		return nil, err
-	}
-	var ans = make([]string, 0, len(list))
-	for _, v := range list {
-		if !v.IsDir() {
-			ans = append(ans, v.Name())
-		}
-	}
-	return ans, nil
+	return network.store().Nodes()
 }
 
 // List known nodes configurations
@@ -95,12 +76,7 @@ func (network *Network) NodesDefinitions() ([]Node, error) {
 
 // Node configuration by node name
 func (network *Network) Node(name string) (*Node, error) {
-	data, err := ioutil.ReadFile(network.NodeFile(name))
-	if err != nil {
-		return nil, err
-	}
-	var nd Node
-	return &nd, nd.Parse(data)
+	return network.store().Node(name)
 }
 
 // Self (as defined in tinc.conf) node definition
@@ -122,8 +98,15 @@ func (network *Network) SelfConfig() (*Node, *Config, error) {
 	return info, cfg, err
 }
 
-// Upgrade network configuration and increase version tag +1
+// Upgrade network configuration and increase version tag +1. Switching to router mode makes self node advertise own
+// address instead of whole network CIDR: nodes of previous versions (switch mode only) will reject it, so all nodes
+// should be upgraded first.
 func (network *Network) Upgrade(upgrade Upgrade) error {
+	unlock, err := network.acquire()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	config, err := network.Read()
 	if err != nil {
 		return err
@@ -140,32 +123,96 @@ func (network *Network) Upgrade(upgrade Upgrade) error {
 		n.Port = upgrade.Port
 		config.Port = upgrade.Port
 	}
+	switch upgrade.DeviceType {
+	case "":
+	case DeviceTypeTap:
+		if config.Userspace() {
+			// back to kernel device: platform-specific defaults (ex: /dev/tapN on darwin)
+			config.DeviceType = upgrade.DeviceType
+			config.Device = ""
+			if err := network.beforeConfigure(config); err != nil {
+				return err
+			}
+		}
+	case DeviceTypeMulticast, DeviceTypeDummy:
+		config.DeviceType = upgrade.DeviceType
+		config.Device = ""
+		if upgrade.DeviceType == DeviceTypeMulticast {
+			config.Device = multicastDevice()
+		}
+	default:
+		return fmt.Errorf("unknown device type %s", upgrade.DeviceType)
+	}
 	if upgrade.Device != "" {
 		config.Device = upgrade.Device
 	}
-	if err := network.Update(config); err != nil {
+	switch upgrade.Mode {
+	case "", config.Mode:
+	case ModeSwitch, ModeRouter:
+		// router mode: own address instead of whole network CIDR (not accepted by nodes of previous versions)
+		config.Mode = upgrade.Mode
+		config.setAddresses(n, n.IP, n.IP6)
+	default:
+		return fmt.Errorf("unknown mode %s", upgrade.Mode)
+	}
+	if upgrade.MTU != 0 {
+		config.MTU = upgrade.MTU
+	}
+	if upgrade.PMTU != 0 {
+		config.PMTU = upgrade.PMTU
+	}
+	if upgrade.PMTUDiscovery != "" {
+		config.PMTUDiscovery = upgrade.PMTUDiscovery
+	}
+	if upgrade.ClampMSS != "" {
+		config.ClampMSS = upgrade.ClampMSS
+	}
+	if err := config.checkMTU(); err != nil {
+		return err
+	}
+	if upgrade.Subnets != nil {
+		if len(upgrade.Subnets) > 0 && config.Mode != ModeRouter {
+			return fmt.Errorf("routed subnets require %s mode, current mode is %q", ModeRouter, config.Mode)
+		}
+		if err := config.setRoutes(n, upgrade.Subnets); err != nil {
+			return err
+		}
+		if err := network.checkOverlaps(config, n); err != nil {
+			return err
+		}
+	}
+	if err := network.update(config); err != nil {
 		return err
 	}
-	return network.put(n)
+	if err := network.put(n); err != nil {
+		return err
+	}
+	return network.renderScripts()
 }
 
 // Put node configuration to known hosts.
-// Prevents overwrite self config and outdated configurations (version less then saved).
-// Checks that node has same subnet as self node
+// Prevents overwrite self config. Outdated configuration (version less then saved) is rejected with
+// ErrOutdatedVersion (before it was silently ignored with nil result), the same version is ignored.
+// Checks that node addresses (IPv4 and IPv6) belong to network CIDR and are not used by other nodes, and that
+// routed subnets do not overlap with subnets of other nodes. Node without VPN addresses (relay) is accepted. Whole network CIDR advertised by nodes of previous versions is
+// replaced by node address.
 func (network *Network) Put(node *Node) error {
 	if !IsValidNodeName(node.Name) {
-		return fmt.Errorf("invalid node name")
+		return fmt.Errorf("%w %s", ErrInvalidNodeName, node.Name)
 	}
 	if node.PublicKey == "" {
-		return fmt.Errorf("empty public key")
+		return fmt.Errorf("%w of node %s", ErrEmptyPublicKey, node.Name)
 	}
-	if node.Subnet == "" {
-		return fmt.Errorf("empty subnet")
+	unlock, err := network.acquire()
+	if err != nil {
+		return err
 	}
-	network.lock.Lock()
-	defer network.lock.Unlock()
+	defer unlock()
 	if n, err := network.Node(node.Name); err == nil && n.Version >= node.Version {
-		// no need to update - saved version is bigger or equal
+		if n.Version > node.Version {
+			return fmt.Errorf("%w of %s: %d, saved %d", ErrOutdatedVersion, node.Name, node.Version, n.Version)
+		}
+		// no need to update - saved version is the same
 		return nil
 	}
 	config, err := network.Read()
@@ -176,44 +223,100 @@ func (network *Network) Put(node *Node) error {
 		// do not touch self node host file
 		return nil
 	}
-	self, err := network.Node(config.Name)
-	if err != nil {
+	node = config.normalizeLegacySubnet(node)
+	if err := config.checkAddresses(node); err != nil {
 		return err
 	}
-	if self.Subnet != node.Subnet {
-		return fmt.Errorf("missmatch subnet for self node (%s) and new node %s (%s)", self.Subnet, node.Name, node.Subnet)
+	if err := network.checkOverlaps(config, node); err != nil {
+		return err
 	}
-	return network.put(node)
+	if other, ip, err := network.conflictingNode(node); err != nil {
+		return err
+	} else if other != "" {
+		return fmt.Errorf("%w: IP %s of new node %s is used by node %s", ErrAddressCollision, ip, node.Name, other)
+	}
+	if err := network.put(node); err != nil {
+		return err
+	}
+	network.updateHostsFiles()
+	return network.renderScripts()
 }
 
-func (network *Network) put(node *Node) error {
-	data, err := node.Build()
+// Assign new free VPN addresses (IPv4 and/or IPv6) to self node, increase version tag +1 and re-generate scripts.
+// New addresses are propagated to other nodes by greeting. Running instance should be restarted to apply it on
+// the interface. Returns updated self node.
+func (network *Network) ReassignIP() (*Node, error) {
+	unlock, err := network.acquire()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	err = ioutil.WriteFile(network.NodeFile(node.Name), data, 0755)
+	defer unlock()
+	config, err := network.Read()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	self, err := network.Node(config.Name)
+	if err != nil {
+		return nil, err
 	}
-	return ApplyOwnerOfSudoUser(network.NodeFile(node.Name))
+	used, err := network.usedIPs(self.Name)
+	if err != nil {
+		return nil, err
+	}
+	var addresses = [2]string{self.IP, self.IP6}
+	for i, cidr := range []string{config.Network, config.Network6} {
+		if cidr == "" {
+			continue
+		}
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parse network subnet: %w", err)
+		}
+		if current := net.ParseIP(addresses[i]); current != nil {
+			used = append(used, current)
+		}
+		ip, err := allocateIP(subnet, used)
+		if err != nil {
+			return nil, err
+		}
+		addresses[i] = ip.String()
+	}
+	config.setAddresses(self, addresses[0], addresses[1])
+	self.Version++
+	if err := network.put(self); err != nil {
+		return nil, err
+	}
+	network.updateHostsFiles()
+	return self, network.renderScripts()
+}
+
+func (network *Network) put(node *Node) error {
+	return network.store().PutNode(node)
 }
 
-// Check that there is tinc.conf file
+// Check that network configuration exists (for default storage: there is tinc.conf file)
 func (network *Network) IsDefined() bool {
+	if network.Store != nil {
+		_, err := network.Store.ReadConfig()
+		return err == nil
+	}
 	v, err := os.Stat(network.configFile())
 	return err == nil && !v.IsDir()
 }
 
 // Configure network: generates IP, folders, files, keys, scripts and so on. Should not be invoked several times.
+// Up to one IPv4 and one IPv6 subnet (dual-stack) could be provided.
 // Due to key generation it could take a while.
-func (network *Network) Configure(subnet *net.IPNet) error {
+func (network *Network) Configure(subnets ...*net.IPNet) error {
 	if !IsValidName(network.Name()) {
-		return fmt.Errorf("invalid network name")
+		return ErrInvalidName
 	}
-	if err := os.MkdirAll(network.hosts(), 0755); err != nil {
+	unlock, err := network.acquire()
+	if err != nil {
 		return err
 	}
-	if err := network.defineConfiguration(subnet); err != nil {
+	defer unlock()
+	if err := network.defineConfiguration(subnets); err != nil {
 		return err
 	}
 	config, err := network.Read()
@@ -224,51 +327,136 @@ func (network *Network) Configure(subnet *net.IPNet) error {
 	if err != nil {
 		return err
 	}
-	if err := network.saveScript("tinc-up", tincUp(config, nodeInfo)); err != nil {
-		return err
-	}
-	if err := network.saveScript("tinc-down", tincDown(config, nodeInfo)); err != nil {
+	if err := network.renderScripts(); err != nil {
 		return err
 	}
+	network.updateHostsFiles()
 
 	if err := network.generateKeysIfNeeded(nodeInfo); err != nil {
 		return fmt.Errorf("%s: generate keys: %w", network.Name(), err)
 	}
-	if err := ApplyOwnerOfSudoUser(network.privateKeyFile()); err != nil {
-		return fmt.Errorf("apply sudo user on private key: %w", err)
-	}
 	return nil
 }
 
-// Pre-run checks and preparations: indexing public nodes, making OS-dependent checks (like installing TAP drivers)
+// Pre-run checks and preparations: indexing public nodes, materializing tinc layout from custom storage,
+// making OS-dependent checks (like installing TAP drivers)
 func (network *Network) Prepare(ctx context.Context, tincBin string) error {
 	config, err := network.Read()
 	if err != nil {
 		return err
 	}
-	if err := network.indexPublicNodes(); err != nil {
+	if err := network.migrateLegacySubnet(); err != nil {
+		return fmt.Errorf("%s: migrate subnet: %w", network.Name(), err)
+	}
+	if err := network.IndexPublicNodes(); err != nil {
 		return fmt.Errorf("%s: index public nodes: %w", network.Name(), err)
 	}
+	if err := network.Materialize(); err != nil {
+		return fmt.Errorf("%s: materialize: %w", network.Name(), err)
+	}
+	if err := network.RenderScripts(); err != nil {
+		return err
+	}
+	network.updateHostsFiles()
+	if config.Userspace() {
+		// no kernel device - nothing to check
+		return nil
+	}
 	return network.postConfigure(ctx, config, tincBin)
 }
 
+// Write tinc layout (tinc.conf, hosts, private key) to Root directory from custom storage. Host files of nodes
+// unknown to the storage are removed. Does nothing for default storage.
+func (network *Network) Materialize() error {
+	if network.Store == nil {
+		return nil
+	}
+	unlock, err := network.acquire()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	layout := &DirStore{Root: network.Root}
+	if err := os.MkdirAll(layout.hosts(), 0755); err != nil {
+		return err
+	}
+
+	config, err := network.Store.ReadConfig()
+	if err != nil {
+		return err
+	}
+	if err := layout.WriteConfig(config); err != nil {
+		return err
+	}
+
+	names, err := network.Store.Nodes()
+	if err != nil {
+		return err
+	}
+	var known = make(map[string]bool, len(names))
+	for _, name := range names {
+		node, err := network.Store.Node(name)
+		if err != nil {
+			return fmt.Errorf("node %s: %w", name, err)
+		}
+		known[name] = true
+		if saved, err := layout.Node(name); err == nil && reflect.DeepEqual(saved, node) {
+			// keep untouched to not trigger hosts watchers
+			continue
+		}
+		if err := layout.PutNode(node); err != nil {
+			return fmt.Errorf("node %s: %w", name, err)
+		}
+	}
+	existent, err := layout.Nodes()
+	if err != nil {
+		return err
+	}
+	for _, name := range existent {
+		if !known[name] {
+			if err := os.Remove(layout.NodeFile(name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	key, err := network.Store.PrivateKey()
+	if os.IsNotExist(err) {
+		// key of previous materialization doesn't belong to the storage anymore
+		err = os.Remove(layout.privateKeyFile())
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	return layout.PutPrivateKey(key)
+}
+
 // Location of PID file (pid.run)
 func (network *Network) Pidfile() string {
 	return filepath.Join(network.Root, "pid.run")
 }
 
-// Remove configuration directories and files
+// Remove configuration directories and files. Custom storage is not touched
 func (network *Network) Destroy() error {
 	return os.RemoveAll(network.Root)
 }
 
 // Location of host file by node name
 func (network *Network) NodeFile(name string) string {
-	name = regexp.MustCompile(`^[^a-zA-Z0-9_]+$`).ReplaceAllString(name, "")
-	return filepath.Join(network.hosts(), name)
+	return (&DirStore{Root: network.Root}).NodeFile(name)
 }
 
-func (network *Network) indexPublicNodes() error {
+// Set ConnectTo in configuration to all known nodes with public address
+func (network *Network) IndexPublicNodes() error {
+	unlock, err := network.acquire()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	config, err := network.Read()
 	if err != nil {
 		return err
@@ -293,49 +481,66 @@ func (network *Network) indexPublicNodes() error {
 
 	config.ConnectTo = publicNodes
 
-	return network.Update(config)
+	return network.update(config)
 }
 
-func (network *Network) defineConfiguration(subnet *net.IPNet) error {
+func (network *Network) defineConfiguration(subnets []*net.IPNet) error {
 	if network.IsDefined() {
 		return nil
 	}
-	mask, bits := subnet.Mask.Size()
-	if bits != 32 {
-		return fmt.Errorf("currently supported only IPv4 subnets (%d bits) but requested %d bits", 32, bits)
+	ipv4, ipv6, err := splitSubnets(subnets)
+	if err != nil {
+		return err
 	}
 	hostname, _ := os.Hostname()
 	suffix := utils.RandStringRunesCustom(6, suffixRunes)
 	nodeName := regexp.MustCompile(`[^a-z0-9]*`).ReplaceAllString(strings.ToLower(hostname), "") + "_" + suffix
-	selfIP := generateRandomIPv4(subnet)
+	used, err := network.usedIPs(nodeName)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	config := &Config{
 		Name:      nodeName,
 		Port:      uint16(30000 + rand.Intn(35535)),
 		Interface: "tinc" + suffix,
-		Mode:      "switch",
-		Mask:      mask,
+		Mode:      ModeSwitch,
 		Broadcast: "mst",
 	}
+	nodeConfig := &Node{
+		Name: nodeName,
+		Port: config.Port,
+	}
+	if ipv4 != nil {
+		selfIP, err := allocateIP(ipv4, used)
+		if err != nil {
+			return err
+		}
+		config.Mask, _ = ipv4.Mask.Size()
+		config.Network = ipv4.String()
+		nodeConfig.IP = selfIP.String()
+	}
+	if ipv6 != nil {
+		selfIP, err := allocateIP(ipv6, used)
+		if err != nil {
+			return err
+		}
+		config.Mask6, _ = ipv6.Mask.Size()
+		config.Network6 = ipv6.String()
+		nodeConfig.IP6 = selfIP.String()
+	}
+	config.setAddresses(nodeConfig, nodeConfig.IP, nodeConfig.IP6)
 
 	if err := network.beforeConfigure(config); err != nil {
 		return err
 	}
 
-	if err := network.Update(config); err != nil {
+	if err := network.update(config); err != nil {
 		return err
 	}
 
-	var version = 1
+	nodeConfig.Version = 1
 	if n, err := network.Node(config.Name); err == nil {
-		version = n.Version + 1
-	}
-
-	nodeConfig := &Node{
-		Name:    nodeName,
-		Subnet:  subnet.String(),
-		Port:    config.Port,
-		Version: version,
-		IP:      selfIP.String(),
+		nodeConfig.Version = n.Version + 1
 	}
 
 	return network.put(nodeConfig)
@@ -345,21 +550,20 @@ func (network *Network) configFile() string {
 	return filepath.Join(network.Root, "tinc.conf")
 }
 
-func (network *Network) hosts() string {
-	return filepath.Join(network.Root, "hosts")
-}
-
 func (network *Network) scriptFile(name string) string {
 	return filepath.Join(network.Root, name+scriptSuffix)
 }
 
-func (network *Network) privateKeyFile() string {
-	return filepath.Join(network.Root, "rsa_key.priv")
+func (network *Network) store() Store {
+	if network.Store != nil {
+		return network.Store
+	}
+	return &DirStore{Root: network.Root}
 }
 
 func (network *Network) saveScript(name string, content string) error {
 	file := network.scriptFile(name)
-	err := ioutil.WriteFile(file, []byte(content), 0755)
+	err := writeFileAtomic(file, []byte(content), 0755)
 	if err != nil {
 		return fmt.Errorf("%s: generate script %s: %w", network.Name(), name, err)
 	}
@@ -371,7 +575,7 @@ func (network *Network) saveScript(name string, content string) error {
 }
 
 func (network *Network) generateKeysIfNeeded(self *Node) error {
-	_, err := os.Stat(network.privateKeyFile())
+	_, err := network.store().PrivateKey()
 	if err == nil {
 		return nil
 	}
@@ -384,10 +588,10 @@ func (network *Network) generateKeysIfNeeded(self *Node) error {
 		return err
 	}
 
-	err = ioutil.WriteFile(network.privateKeyFile(), pem.EncodeToMemory(&pem.Block{
+	err = network.store().PutPrivateKey(pem.EncodeToMemory(&pem.Block{
 		Type:  "RSA PRIVATE KEY",
 		Bytes: x509.MarshalPKCS1PrivateKey(private),
-	}), 0755)
+	}))
 	if err != nil {
 		return fmt.Errorf("save private key: %w", err)
 	}
@@ -411,21 +615,6 @@ func IsValidNodeName(name string) bool {
 	return regexp.MustCompile(`^[a-zA-Z0-9_]+$`).MatchString(name)
 }
 
-func generateRandomIPv4(subnet *net.IPNet) net.IP {
-	netsize, bits := subnet.Mask.Size()
-	baseIP := binary.BigEndian.Uint32(subnet.IP)
-
-	maxIP := (1 << (bits - netsize)) - 1
-	if maxIP <= 0 {
-		return subnet.IP
-	}
-	genIP := baseIP + (1 + rand.Uint32()%uint32(maxIP))
-
-	var ip [4]byte
-	binary.BigEndian.PutUint32(ip[:], uint32(genIP))
-	return net.IP(ip[:])
-}
-
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
@@ -2,32 +2,218 @@ package network
 
 import (
 	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"text/template"
 )
 
-var (
-	tincUpTpl   = template.Must(template.New("").Parse(tincUpTxt))
-	tincDownTpl = template.Must(template.New("").Parse(tincDownText))
+// Scripts invoked by tincd
+const (
+	ScriptTincUp     = "tinc-up"
+	ScriptTincDown   = "tinc-down"
+	ScriptHostUp     = "host-up"
+	ScriptHostDown   = "host-down"
+	ScriptSubnetUp   = "subnet-up"
+	ScriptSubnetDown = "subnet-down"
 )
 
-type params struct {
-	Node   *Node
-	Config *Config
+// All supported scripts types
+var Scripts = []string{ScriptTincUp, ScriptTincDown, ScriptHostUp, ScriptHostDown, ScriptSubnetUp, ScriptSubnetDown}
+
+// First argument of hook binary invocation (see Config.Hook and ReadScriptEvent)
+const HookCommand = "tinc-hook"
+
+// invocation of hook binary (if defined) with name of script and environment provided by tincd
+const hookTxt = `{{if .Hook}}"{{.Hook}}" ` + HookCommand + ` {{.Script}}
+{{end}}`
+
+// built-in templates. Scripts without built-in template are generated only if hook is defined
+var builtinTemplates = map[string]string{
+	ScriptTincUp:     tincUpTxt + hookTxt,
+	ScriptTincDown:   tincDownText + hookTxt,
+	ScriptHostUp:     scriptHeader + hookTxt,
+	ScriptHostDown:   scriptHeader + hookTxt,
+	ScriptSubnetUp:   subnetUpText + hookTxt,
+	ScriptSubnetDown: subnetDownText + hookTxt,
 }
 
-func tincUp(config *Config, node *Node) string {
-	return mustRender(tincUpTpl, params{node, config})
+// Data available in scripts templates
+type ScriptParams struct {
+	Script    string  // script name (tinc-up, host-up, ...)
+	Hook      string  // hook binary (if defined)
+	Node      *Node   // self node
+	Config    *Config // network configuration
+	Nodes     []Node  // all known nodes (including self)
+	Native    bool    // interface is configured by library (see Config.NativeInterface)
+	Userspace bool    // no kernel interface (see Config.Userspace)
 }
 
-func tincDown(config *Config, node *Node) string {
-	return mustRender(tincDownTpl, params{node, config})
+// Scripts should configure interface: not in native or userspace mode
+func (params ScriptParams) ConfigureInterface() bool {
+	return !params.Native && !params.Userspace
 }
 
-func mustRender(tpl *template.Template, params interface{}) string {
-	var out bytes.Buffer
-	err := tpl.Execute(&out, params)
+// Subnet scripts should add routes to subnets of other nodes: interface is configured by scripts in router mode
+func (params ScriptParams) RouteSubnets() bool {
+	return params.ConfigureInterface() && params.Config.Mode == ModeRouter
+}
+
+// CIDR of whole VPN network (IPv4 and/or IPv6). Already routed to interface by its address, but advertised by nodes
+// of previous versions
+func (params ScriptParams) VPNNetworks() []string {
+	var ans []string
+	for _, cidr := range []string{params.Config.Network, params.Config.Network6} {
+		if cidr != "" {
+			ans = append(ans, cidr)
+		}
+	}
+	return ans
+}
+
+// Event from tincd passed to hook binary
+type ScriptEvent struct {
+	Script        string // script name (tinc-up, host-up, ...)
+	Network       string // NETNAME
+	Name          string // NAME - self node name
+	Device        string // DEVICE
+	Interface     string // INTERFACE
+	Node          string // NODE - remote node (host-* and subnet-* scripts)
+	RemoteAddress string // REMOTEADDRESS (host-* and subnet-* scripts)
+	RemotePort    string // REMOTEPORT (host-* and subnet-* scripts)
+	Subnet        string // SUBNET (subnet-* scripts)
+	Weight        string // WEIGHT (subnet-* scripts)
+}
+
+// Read script event in hook binary. Args should be command line arguments without program name (os.Args[1:]).
+// Returns false if program is not invoked as a hook.
+func ReadScriptEvent(args []string) (*ScriptEvent, bool) {
+	if len(args) < 2 || args[0] != HookCommand {
+		return nil, false
+	}
+	return &ScriptEvent{
+		Script:        args[1],
+		Network:       os.Getenv("NETNAME"),
+		Name:          os.Getenv("NAME"),
+		Device:        os.Getenv("DEVICE"),
+		Interface:     os.Getenv("INTERFACE"),
+		Node:          os.Getenv("NODE"),
+		RemoteAddress: os.Getenv("REMOTEADDRESS"),
+		RemotePort:    os.Getenv("REMOTEPORT"),
+		Subnet:        os.Getenv("SUBNET"),
+		Weight:        os.Getenv("WEIGHT"),
+	}, true
+}
+
+// Location of user-defined template for script. User-defined templates take precedence over built-in
+func (network *Network) TemplateFile(script string) string {
+	return filepath.Join(network.Root, "templates", script)
+}
+
+// Save user-defined template (see ScriptParams for available data) for script and re-render scripts.
+// Empty content removes template, so built-in one will be used.
+func (network *Network) SetTemplate(script string, content string) error {
+	if !isScript(script) {
+		return fmt.Errorf("unknown script %s", script)
+	}
+	unlock, err := network.acquire()
 	if err != nil {
-		panic(err)
+		return err
+	}
+	defer unlock()
+	file := network.TemplateFile(script)
+	if content == "" {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return network.renderScripts()
+	}
+	if _, err := template.New(script).Parse(content); err != nil {
+		return fmt.Errorf("parse template %s: %w", script, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(file, []byte(content), 0644); err != nil {
+		return err
+	}
+	return network.renderScripts()
+}
+
+// Re-generate all scripts by templates. Called automatically after changes in configuration or known nodes.
+func (network *Network) RenderScripts() error {
+	unlock, err := network.acquire()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return network.renderScripts()
+}
+
+func (network *Network) renderScripts() error {
+	self, config, err := network.SelfConfig()
+	if err != nil {
+		return err
+	}
+	nodes, err := network.NodesDefinitions()
+	if err != nil {
+		return err
+	}
+	for _, script := range Scripts {
+		tpl, err := network.scriptTemplate(script, config.Hook)
+		if err != nil {
+			return fmt.Errorf("%s: %w", network.Name(), err)
+		}
+		if tpl == nil {
+			continue
+		}
+		var out bytes.Buffer
+		err = tpl.Execute(&out, ScriptParams{
+			Script:    script,
+			Hook:      config.Hook,
+			Node:      self,
+			Config:    config,
+			Nodes:     nodes,
+			Native:    config.NativeInterface,
+			Userspace: config.Userspace(),
+		})
+		if err != nil {
+			return fmt.Errorf("%s: render script %s: %w", network.Name(), script, err)
+		}
+		if err := network.saveScript(script, out.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// template of script: user-defined or built-in. Returns nil if script should not be generated
+func (network *Network) scriptTemplate(script string, hook string) (*template.Template, error) {
+	text, err := ioutil.ReadFile(network.TemplateFile(script))
+	if os.IsNotExist(err) {
+		if script == ScriptHostUp || script == ScriptHostDown {
+			if hook == "" {
+				return nil, nil
+			}
+		}
+		return template.New(script).Parse(builtinTemplates[script])
+	}
+	if err != nil {
+		return nil, err
+	}
+	tpl, err := template.New(script).Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("parse template %s: %w", script, err)
+	}
+	return tpl, nil
+}
+
+func isScript(name string) bool {
+	for _, script := range Scripts {
+		if script == name {
+			return true
+		}
 	}
-	return out.String()
+	return false
 }
@@ -11,12 +11,57 @@ import (
 
 const scriptSuffix = ""
 
+const scriptHeader = "#!/bin/sh\n"
+
 const tincUpTxt = `#!/bin/sh
+{{- if .ConfigureInterface}}
+{{- if .Node.IP}}
 ifconfig $INTERFACE {{.Node.IP}}/{{.Config.Mask}}
+{{- end}}
+{{- if .Node.IP6}}
+ifconfig $INTERFACE inet6 {{.Node.IP6}} prefixlen {{.Config.Mask6}} alias
+{{- end}}
+{{- if .Config.MTU}}
+ifconfig $INTERFACE mtu {{.Config.MTU}}
+{{- end}}
+ifconfig $INTERFACE up
+{{- end}}
 `
 
 const tincDownText = `#!/bin/sh
+{{- if .ConfigureInterface}}
 ifconfig $INTERFACE down
+{{- end}}
+`
+
+// routes to subnets behind other nodes (router mode). Skips own subnets, whole VPN network and MAC addresses.
+// Routes have no metric: tincd itself chooses node by subnet weight
+const subnetUpText = `#!/bin/sh
+{{- if .RouteSubnets}}
+if [ "$NODE" != "$NAME" ]; then
+	case "${SUBNET%%#*}" in
+{{- range .VPNNetworks}}
+	{{.}}) ;;
+{{- end}}
+	*:*/*) route -n add -inet6 "${SUBNET%%#*}" -interface $INTERFACE ;;
+	*/*) route -n add -net "${SUBNET%%#*}" -interface $INTERFACE ;;
+	esac
+fi
+{{- end}}
+`
+
+const subnetDownText = `#!/bin/sh
+{{- if .RouteSubnets}}
+if [ "$NODE" != "$NAME" ]; then
+	case "${SUBNET%%#*}" in
+{{- range .VPNNetworks}}
+	{{.}}) ;;
+{{- end}}
+	*:*/*) route -n delete -inet6 "${SUBNET%%#*}" -interface $INTERFACE ;;
+	*/*) route -n delete -net "${SUBNET%%#*}" -interface $INTERFACE ;;
+	esac
+fi
+{{- end}}
 `
 
 func postProcessScript(filename string) error {
@@ -11,14 +11,61 @@ import (
 
 const scriptSuffix = ""
 
+const scriptHeader = "#!/bin/sh\n"
+
 const tincUpTxt = `#!/bin/sh
+{{- if .ConfigureInterface}}
+{{- if .Node.IP}}
 ip addr add {{.Node.IP}}/{{.Config.Mask}} dev $INTERFACE
+{{- end}}
+{{- if .Node.IP6}}
+ip -6 addr add {{.Node.IP6}}/{{.Config.Mask6}} dev $INTERFACE
+{{- end}}
+{{- if .Config.MTU}}
+ip link set dev $INTERFACE mtu {{.Config.MTU}}
+{{- end}}
 ip link set dev $INTERFACE up
+{{- end}}
 `
 
 const tincDownText = `#!/bin/sh
+{{- if .ConfigureInterface}}
+{{- if .Node.IP}}
 ip addr del {{.Node.IP}}/{{.Config.Mask}} dev $INTERFACE
+{{- end}}
+{{- if .Node.IP6}}
+ip -6 addr del {{.Node.IP6}}/{{.Config.Mask6}} dev $INTERFACE
+{{- end}}
 ip link set dev $INTERFACE down
+{{- end}}
+`
+
+// routes to subnets behind other nodes (router mode) with subnet weight as metric, so same subnet advertised by
+// several nodes has separate routes. Skips own subnets, whole VPN network and MAC addresses
+const subnetUpText = `#!/bin/sh
+{{- if .RouteSubnets}}
+if [ "$NODE" != "$NAME" ]; then
+	case "${SUBNET%%#*}" in
+{{- range .VPNNetworks}}
+	{{.}}) ;;
+{{- end}}
+	*/*) ip route add "${SUBNET%%#*}" dev $INTERFACE metric "${WEIGHT:-10}" ;;
+	esac
+fi
+{{- end}}
+`
+
+const subnetDownText = `#!/bin/sh
+{{- if .RouteSubnets}}
+if [ "$NODE" != "$NAME" ]; then
+	case "${SUBNET%%#*}" in
+{{- range .VPNNetworks}}
+	{{.}}) ;;
+{{- end}}
+	*/*) ip route del "${SUBNET%%#*}" dev $INTERFACE metric "${WEIGHT:-10}" ;;
+	esac
+fi
+{{- end}}
 `
 
 func postProcessScript(filename string) error {
@@ -0,0 +1,102 @@
+package network
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNetwork_SetTemplate(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+
+	ntw := &Network{Root: filepath.Join(tmp, "scripts")}
+	if err := ntw.Update(&Config{Name: "alfa", Mode: ModeRouter, Network: "10.10.0.0/16", Mask: 16, Hook: "/usr/bin/hook"}); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := ntw.put(&Node{Name: "alfa", Subnet: "10.10.1.2/32", IP: "10.10.1.2", Version: 1}); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := ntw.put(&Node{Name: "beta", Subnet: "10.10.1.3/32", IP: "10.10.1.3", Version: 1}); err != nil {
+		t.Error(err)
+		return
+	}
+	// hook is persisted in configuration, so scripts re-rendered by other instance still call it
+	if err := (&Network{Root: ntw.Root}).RenderScripts(); err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := ioutil.ReadFile(ntw.scriptFile(ScriptHostUp))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !strings.Contains(string(data), `"/usr/bin/hook" tinc-hook host-up`) {
+		t.Errorf("hook not called in host-up:\n%s", data)
+	}
+	data, err = ioutil.ReadFile(ntw.scriptFile(ScriptSubnetUp))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !strings.Contains(string(data), "route") || !strings.Contains(string(data), "10.10.0.0/16") {
+		t.Errorf("subnet-up should add routes except VPN network:\n%s", data)
+	}
+
+	if err := ntw.SetTemplate(ScriptTincUp, "{{range .Nodes}}{{.Name}}={{.IP}}\n{{end}}"); err != nil {
+		t.Error(err)
+		return
+	}
+	data, err = ioutil.ReadFile(ntw.scriptFile(ScriptTincUp))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(data) != "alfa=10.10.1.2\nbeta=10.10.1.3\n" {
+		t.Errorf("unexpected tinc-up:\n%s", data)
+	}
+
+	if err := ntw.SetTemplate(ScriptTincUp, "{{.Unknown"); err == nil {
+		t.Error("invalid template accepted")
+	}
+	if err := ntw.SetTemplate("unknown", "echo"); err == nil {
+		t.Error("unknown script accepted")
+	}
+
+	if err := ntw.SetTemplate(ScriptTincUp, ""); err != nil {
+		t.Error(err)
+		return
+	}
+	data, err = ioutil.ReadFile(ntw.scriptFile(ScriptTincUp))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !strings.Contains(string(data), "10.10.1.2") {
+		t.Errorf("built-in template not restored:\n%s", data)
+	}
+}
+
+func TestReadScriptEvent(t *testing.T) {
+	if _, ok := ReadScriptEvent([]string{"run"}); ok {
+		t.Error("not a hook invocation")
+	}
+	os.Setenv("NODE", "beta")
+	defer os.Unsetenv("NODE")
+	event, ok := ReadScriptEvent([]string{HookCommand, ScriptHostUp})
+	if !ok {
+		t.Error("hook invocation not detected")
+		return
+	}
+	if event.Script != ScriptHostUp || event.Node != "beta" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+}
@@ -2,12 +2,62 @@ package network
 
 const scriptSuffix = ".bat"
 
+const scriptHeader = "@echo off\n"
+
 const tincUpTxt = `
+{{- if .ConfigureInterface}}
+{{- if .Node.IP}}
 netsh interface ipv4 set address name=%INTERFACE% static {{.Node.IP}}/{{.Config.Mask}} store=persistent
+{{- end}}
+{{- if .Node.IP6}}
+netsh interface ipv6 add address interface=%INTERFACE% address={{.Node.IP6}}/{{.Config.Mask6}} store=persistent
+{{- end}}
+{{- if .Config.MTU}}
+netsh interface ipv4 set subinterface "%INTERFACE%" mtu={{.Config.MTU}} store=persistent
+{{- end}}
+{{- end}}
 `
 
 const tincDownText = ``
 
+// routes (IPv4 and IPv6) to subnets behind other nodes (router mode) with subnet weight as metric. Skips own
+// subnets, whole VPN network and MAC addresses
+const subnetUpText = `@echo off
+{{- if .RouteSubnets}}
+if "%NODE%"=="%NAME%" goto done
+echo %SUBNET% | findstr /c:"/" >nul || goto done
+for /f "delims=#" %%s in ("%SUBNET%") do set ROUTE=%%s
+{{- range .VPNNetworks}}
+if "%ROUTE%"=="{{.}}" goto done
+{{- end}}
+set METRIC=%WEIGHT%
+if "%METRIC%"=="" set METRIC=10
+echo %ROUTE% | findstr /c:":" >nul && goto ipv6
+netsh interface ipv4 add route %ROUTE% "%INTERFACE%" metric=%METRIC% store=active
+goto done
+:ipv6
+netsh interface ipv6 add route %ROUTE% "%INTERFACE%" metric=%METRIC% store=active
+:done
+{{- end}}
+`
+
+const subnetDownText = `@echo off
+{{- if .RouteSubnets}}
+if "%NODE%"=="%NAME%" goto done
+echo %SUBNET% | findstr /c:"/" >nul || goto done
+for /f "delims=#" %%s in ("%SUBNET%") do set ROUTE=%%s
+{{- range .VPNNetworks}}
+if "%ROUTE%"=="{{.}}" goto done
+{{- end}}
+echo %ROUTE% | findstr /c:":" >nul && goto ipv6
+netsh interface ipv4 delete route %ROUTE% "%INTERFACE%" store=active
+goto done
+:ipv6
+netsh interface ipv6 delete route %ROUTE% "%INTERFACE%" store=active
+:done
+{{- end}}
+`
+
 func postProcessScript(filename string) error { return nil }
 
 func ApplyOwnerOfSudoUser(filename string) error { return nil }
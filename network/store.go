@@ -0,0 +1,149 @@
+package network
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Storage of network definition: configuration, known nodes and keys. Implementations should return error
+// satisfying os.IsNotExist for missing configuration, nodes or keys.
+type Store interface {
+	// Read network configuration
+	ReadConfig() (*Config, error)
+	// Save network configuration
+	WriteConfig(config *Config) error
+	// List known nodes names
+	Nodes() ([]string, error)
+	// Node configuration by node name
+	Node(name string) (*Node, error)
+	// Save node configuration
+	PutNode(node *Node) error
+	// Private key of self node in PEM format
+	PrivateKey() ([]byte, error)
+	// Save private key of self node in PEM format
+	PutPrivateKey(data []byte) error
+}
+
+// Default storage: tinc layout (tinc.conf, conf.d, hosts/, rsa_key.priv) and library settings (SettingsFile)
+// in directory.
+// Changes owner of written files to SUDO user (if applicable).
+type DirStore struct {
+	Root string // directory with tinc layout
+}
+
+// Read tinc.conf and library settings merged with conf.d/*.conf fragments
+func (store *DirStore) ReadConfig() (*Config, error) {
+	return ConfigFromDir(store.Root)
+}
+
+// Write tinc.conf and library settings (SettingsFile). Keys defined by user fragments in conf.d are not written, so
+// fragments are never overwritten or shadowed. Changing key defined by fragment returns ErrOverridden.
+// Keys for tincd are written to tinc.conf (not to own conf.d fragment), because tinc 1.0 does not read conf.d.
+func (store *DirStore) WriteConfig(config *Config) error {
+	err := os.MkdirAll(store.hosts(), 0755)
+	if err != nil {
+		return err
+	}
+	err = ApplyOwnerOfSudoUser(store.hosts())
+	if err != nil {
+		return err
+	}
+	err = ApplyOwnerOfSudoUser(store.Root)
+	if err != nil {
+		return err
+	}
+	managed, err := config.managed()
+	if err != nil {
+		return err
+	}
+	tinc, library := managed.split()
+	if err := store.writeConfigFile(store.configFile(), tinc); err != nil {
+		return err
+	}
+	return store.writeConfigFile(store.settingsFile(), library)
+}
+
+func (store *DirStore) writeConfigFile(file string, config *Config) error {
+	data, err := config.Build()
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(file, data, 0644)
+	if err != nil {
+		return err
+	}
+	return ApplyOwnerOfSudoUser(file)
+}
+
+func (store *DirStore) Nodes() ([]string, error) {
+	list, err := ioutil.ReadDir(store.hosts())
+	if err != nil {
+		return nil, err
+	}
+	var ans = make([]string, 0, len(list))
+	for _, v := range list {
+		// hidden files are temporary files of atomic writes
+		if !v.IsDir() && !strings.HasPrefix(v.Name(), ".") {
+			ans = append(ans, v.Name())
+		}
+	}
+	return ans, nil
+}
+
+func (store *DirStore) Node(name string) (*Node, error) {
+	data, err := ioutil.ReadFile(store.NodeFile(name))
+	if err != nil {
+		return nil, err
+	}
+	var nd Node
+	return &nd, nd.Parse(data)
+}
+
+func (store *DirStore) PutNode(node *Node) error {
+	data, err := node.Build()
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(store.NodeFile(node.Name), data, 0644)
+	if err != nil {
+		return err
+	}
+	return ApplyOwnerOfSudoUser(store.NodeFile(node.Name))
+}
+
+func (store *DirStore) PrivateKey() ([]byte, error) {
+	return ioutil.ReadFile(store.privateKeyFile())
+}
+
+func (store *DirStore) PutPrivateKey(data []byte) error {
+	err := writeFileAtomic(store.privateKeyFile(), data, 0600)
+	if err != nil {
+		return err
+	}
+	return ApplyOwnerOfSudoUser(store.privateKeyFile())
+}
+
+// Location of host file by node name
+func (store *DirStore) NodeFile(name string) string {
+	name = regexp.MustCompile(`^[^a-zA-Z0-9_]+$`).ReplaceAllString(name, "")
+	return filepath.Join(store.hosts(), name)
+}
+
+func (store *DirStore) configFile() string {
+	return filepath.Join(store.Root, "tinc.conf")
+}
+
+func (store *DirStore) settingsFile() string {
+	return filepath.Join(store.Root, SettingsFile)
+}
+
+func (store *DirStore) hosts() string {
+	return filepath.Join(store.Root, "hosts")
+}
+
+func (store *DirStore) privateKeyFile() string {
+	return filepath.Join(store.Root, "rsa_key.priv")
+}
@@ -0,0 +1,128 @@
+package network
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Storage of network definition in single JSON file. File is rewritten atomically on each change.
+type FileStore struct {
+	Path string // location of JSON file
+	lock sync.Mutex
+}
+
+type fileStoreContent struct {
+	Config     *Config         `json:"config,omitempty"`
+	Nodes      map[string]Node `json:"nodes,omitempty"`
+	PrivateKey string          `json:"privateKey,omitempty"`
+}
+
+func (store *FileStore) ReadConfig() (*Config, error) {
+	content, err := store.read()
+	if err != nil {
+		return nil, err
+	}
+	if content.Config == nil {
+		return nil, os.ErrNotExist
+	}
+	return content.Config, nil
+}
+
+func (store *FileStore) WriteConfig(config *Config) error {
+	managed, err := config.managed()
+	if err != nil {
+		return err
+	}
+	return store.update(func(content *fileStoreContent) {
+		content.Config = managed
+	})
+}
+
+func (store *FileStore) Nodes() ([]string, error) {
+	content, err := store.read()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ans = make([]string, 0, len(content.Nodes))
+	for name := range content.Nodes {
+		ans = append(ans, name)
+	}
+	sort.Strings(ans)
+	return ans, nil
+}
+
+func (store *FileStore) Node(name string) (*Node, error) {
+	content, err := store.read()
+	if err != nil {
+		return nil, err
+	}
+	node, ok := content.Nodes[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return &node, nil
+}
+
+func (store *FileStore) PutNode(node *Node) error {
+	return store.update(func(content *fileStoreContent) {
+		if content.Nodes == nil {
+			content.Nodes = make(map[string]Node)
+		}
+		content.Nodes[node.Name] = *node
+	})
+}
+
+func (store *FileStore) PrivateKey() ([]byte, error) {
+	content, err := store.read()
+	if err != nil {
+		return nil, err
+	}
+	if content.PrivateKey == "" {
+		return nil, os.ErrNotExist
+	}
+	return []byte(content.PrivateKey), nil
+}
+
+func (store *FileStore) PutPrivateKey(data []byte) error {
+	return store.update(func(content *fileStoreContent) {
+		content.PrivateKey = string(data)
+	})
+}
+
+func (store *FileStore) read() (*fileStoreContent, error) {
+	data, err := ioutil.ReadFile(store.Path)
+	if err != nil {
+		return nil, err
+	}
+	var content fileStoreContent
+	return &content, json.Unmarshal(data, &content)
+}
+
+func (store *FileStore) update(modify func(content *fileStoreContent)) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	content, err := store.read()
+	if os.IsNotExist(err) {
+		content, err = &fileStoreContent{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	modify(content)
+	data, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return err
+	}
+	// file contains private key
+	err = writeFileAtomic(store.Path, data, 0600)
+	if err != nil {
+		return err
+	}
+	return ApplyOwnerOfSudoUser(store.Path)
+}
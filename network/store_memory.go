@@ -0,0 +1,91 @@
+package network
+
+import (
+	"os"
+	"sort"
+	"sync"
+)
+
+// In-memory storage of network definition (mostly for tests). Zero value is ready to use.
+type MemoryStore struct {
+	lock       sync.RWMutex
+	config     *Config
+	nodes      map[string]Node
+	privateKey []byte
+}
+
+func (store *MemoryStore) ReadConfig() (*Config, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	if store.config == nil {
+		return nil, os.ErrNotExist
+	}
+	cp := *store.config
+	cp.ConnectTo = append([]string(nil), store.config.ConnectTo...)
+	return &cp, nil
+}
+
+func (store *MemoryStore) WriteConfig(config *Config) error {
+	managed, err := config.managed()
+	if err != nil {
+		return err
+	}
+	cp := *managed
+	cp.ConnectTo = append([]string(nil), managed.ConnectTo...)
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.config = &cp
+	return nil
+}
+
+func (store *MemoryStore) Nodes() ([]string, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	var ans = make([]string, 0, len(store.nodes))
+	for name := range store.nodes {
+		ans = append(ans, name)
+	}
+	sort.Strings(ans)
+	return ans, nil
+}
+
+func (store *MemoryStore) Node(name string) (*Node, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	node, ok := store.nodes[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	node.Address = append([]Address(nil), node.Address...)
+	node.Subnets = append([]string(nil), node.Subnets...)
+	return &node, nil
+}
+
+func (store *MemoryStore) PutNode(node *Node) error {
+	cp := *node
+	cp.Address = append([]Address(nil), node.Address...)
+	cp.Subnets = append([]string(nil), node.Subnets...)
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if store.nodes == nil {
+		store.nodes = make(map[string]Node)
+	}
+	store.nodes[node.Name] = cp
+	return nil
+}
+
+func (store *MemoryStore) PrivateKey() ([]byte, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	if store.privateKey == nil {
+		return nil, os.ErrNotExist
+	}
+	return append([]byte(nil), store.privateKey...), nil
+}
+
+func (store *MemoryStore) PutPrivateKey(data []byte) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.privateKey = append([]byte(nil), data...)
+	return nil
+}
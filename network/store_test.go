@@ -0,0 +1,200 @@
+package network
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryStore_Materialize(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+
+	_, subnet, _ := net.ParseCIDR("10.10.0.0/16")
+	ntw := &Network{Root: filepath.Join(tmp, "memnet"), Store: &MemoryStore{}}
+	if err := ntw.Configure(subnet); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := os.Stat(filepath.Join(ntw.Root, "tinc.conf")); !os.IsNotExist(err) {
+		t.Error("tinc.conf should not be created before materialization")
+		return
+	}
+
+	self, err := ntw.Self()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if self.PublicKey == "" {
+		t.Error("public key not saved")
+	}
+	// stale host file should be removed
+	if err := os.MkdirAll(filepath.Join(ntw.Root, "hosts"), 0755); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := ioutil.WriteFile(ntw.NodeFile("stale"), []byte("Port = 1\n"), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := ntw.Materialize(); err != nil {
+		t.Error(err)
+		return
+	}
+	layout := &Network{Root: ntw.Root}
+	cfg, err := layout.Read()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if cfg.Name != self.Name {
+		t.Errorf("materialized name %s, expected %s", cfg.Name, self.Name)
+	}
+	nodes, err := layout.Nodes()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(nodes) != 1 || nodes[0] != self.Name {
+		t.Errorf("unexpected materialized nodes: %v", nodes)
+	}
+	if _, err := os.Stat(filepath.Join(ntw.Root, "rsa_key.priv")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMemoryStore_MaterializeRemovesStaleKey(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+
+	store := &MemoryStore{}
+	if err := store.WriteConfig(&Config{Name: "alice"}); err != nil {
+		t.Error(err)
+		return
+	}
+	ntw := &Network{Root: tmp, Store: store}
+	if err := ioutil.WriteFile(filepath.Join(tmp, "rsa_key.priv"), []byte("stale"), 0600); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := ntw.Materialize(); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "rsa_key.priv")); !os.IsNotExist(err) {
+		t.Error("stale private key should be removed")
+	}
+}
+
+func TestMemoryStore_NodeCopy(t *testing.T) {
+	store := &MemoryStore{}
+	node := &Node{Name: "alice", Subnet: "10.0.0.1/32", Subnets: []string{"192.168.0.0/24"}, Address: []Address{{Host: "example.com"}}}
+	if err := store.PutNode(node); err != nil {
+		t.Error(err)
+		return
+	}
+	node.Subnets[0] = "192.168.1.0/24"
+	saved, err := store.Node("alice")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if saved.Subnets[0] != "192.168.0.0/24" {
+		t.Error("stored subnets changed by caller")
+	}
+	saved.Subnets[0] = "192.168.2.0/24"
+	saved.Address[0].Host = "example.org"
+	again, err := store.Node("alice")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if again.Subnets[0] != "192.168.0.0/24" || again.Address[0].Host != "example.com" {
+		t.Error("stored node changed by caller")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "network.json")
+	store := &FileStore{Path: path}
+	if _, err := store.ReadConfig(); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error for empty store, got %v", err)
+	}
+	if nodes, err := store.Nodes(); err != nil || len(nodes) != 0 {
+		t.Errorf("expected no nodes, got %v (%v)", nodes, err)
+	}
+	if _, err := store.PrivateKey(); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error for private key, got %v", err)
+	}
+
+	_, subnet, _ := net.ParseCIDR("10.20.0.0/16")
+	ntw := &Network{Root: filepath.Join(tmp, "filenet"), Store: store}
+	if err := ntw.Configure(subnet); err != nil {
+		t.Error(err)
+		return
+	}
+	self, err := ntw.Self()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := store.PutNode(&Node{Name: "bob", Subnet: "10.20.0.2/32", PublicKey: "key"}); err != nil {
+		t.Error(err)
+		return
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Error(err)
+		return
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("unexpected file mode %v", info.Mode().Perm())
+	}
+
+	// everything should be restored from file by another instance
+	restored := &Network{Root: ntw.Root, Store: &FileStore{Path: path}}
+	cfg, err := restored.Read()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if cfg.Name != self.Name {
+		t.Errorf("restored name %s, expected %s", cfg.Name, self.Name)
+	}
+	nodes, err := restored.Nodes()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(nodes) != 2 || nodes[0] != "bob" && nodes[1] != "bob" {
+		t.Errorf("unexpected restored nodes: %v", nodes)
+	}
+	bob, err := restored.Node("bob")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if bob.Subnet != "10.20.0.2/32" || bob.PublicKey != "key" {
+		t.Errorf("unexpected restored node: %+v", bob)
+	}
+	if _, err := restored.Store.PrivateKey(); err != nil {
+		t.Error(err)
+	}
+}
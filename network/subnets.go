@@ -0,0 +1,326 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	ModeSwitch = "switch" // (default) nodes exchange ethernet frames, subnets are informational
+	ModeRouter = "router" // packets routed by subnets advertised by nodes
+)
+
+// Single-address subnet (/32 or /128) advertised by node for own VPN address
+func hostSubnet(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if parsed.To4() != nil {
+		return parsed.String() + "/32"
+	}
+	return parsed.String() + "/128"
+}
+
+// Subnets advertised for own VPN addresses of node
+func (n *Node) hostSubnets() []string {
+	var ans []string
+	for _, ip := range []string{n.IP, n.IP6} {
+		if subnet := hostSubnet(ip); subnet != "" {
+			ans = append(ans, subnet)
+		}
+	}
+	return ans
+}
+
+// Subnets advertised by node for own VPN addresses. In router mode it is own address (/32 or /128). In switch mode
+// (subnets are informational) it is whole network CIDR, as nodes of previous versions advertise: they accept only
+// nodes with the same subnet as self.
+func (cfg *Config) ownSubnets(n *Node) []string {
+	if cfg.Mode == ModeRouter {
+		return n.hostSubnets()
+	}
+	var ans []string
+	for _, family := range []struct {
+		network string
+		ip      string
+	}{{cfg.Network, n.IP}, {cfg.Network6, n.IP6}} {
+		if family.network != "" && family.ip != "" {
+			ans = append(ans, family.network)
+		}
+	}
+	return ans
+}
+
+// replace advertised subnets of own VPN addresses (see ownSubnets), keeping other (routed) subnets
+func (cfg *Config) setAddresses(n *Node, ip, ip6 string) {
+	routed := cfg.routedSubnets(n)
+	n.IP = ip
+	n.IP6 = ip6
+	n.setSubnets(append(cfg.ownSubnets(n), routed...))
+}
+
+// Subnets routed by node (site-to-site): all advertised subnets except own VPN addresses
+func (n *Node) RoutedSubnets() []string {
+	var own = make(map[string]bool)
+	for _, subnet := range n.hostSubnets() {
+		own[subnet] = true
+	}
+	var ans []string
+	for _, subnet := range n.AllSubnets() {
+		if !own[subnet] {
+			ans = append(ans, subnet)
+		}
+	}
+	return ans
+}
+
+// subnets routed by node except whole network CIDR (advertised in switch mode)
+func (cfg *Config) routedSubnets(n *Node) []string {
+	var ans []string
+	for _, subnet := range n.RoutedSubnets() {
+		if !sameSubnet(subnet, cfg.Network) && !sameSubnet(subnet, cfg.Network6) {
+			ans = append(ans, subnet)
+		}
+	}
+	return ans
+}
+
+// replace routed subnets, keeping own VPN addresses
+func (cfg *Config) setRoutes(n *Node, routes []string) error {
+	var subnets = cfg.ownSubnets(n)
+	for _, route := range routes {
+		ipNet, err := parseSubnet(route)
+		if err != nil {
+			return err
+		}
+		subnets = append(subnets, ipNet.String())
+	}
+	n.setSubnets(subnets)
+	return nil
+}
+
+// parse tinc subnet (CIDR with optional #weight suffix)
+func parseSubnet(subnet string) (*net.IPNet, error) {
+	if idx := strings.Index(subnet, "#"); idx != -1 {
+		subnet = subnet[:idx]
+	}
+	_, ipNet, err := net.ParseCIDR(strings.TrimSpace(subnet))
+	if err != nil {
+		return nil, fmt.Errorf("parse subnet %s: %w", subnet, err)
+	}
+	return ipNet, nil
+}
+
+func overlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// Nodes of previous versions (and nodes in switch mode) advertise whole network CIDR instead of own address.
+// In router mode returns copy of node with such subnet replaced by own address (/32 or /128), so legacy CIDR is not
+// treated as routed network. In switch mode node is returned as is: it is forwarded to other nodes by greeting, and
+// nodes of previous versions accept only whole network CIDR.
+func (cfg *Config) normalizeLegacySubnet(node *Node) *Node {
+	if cfg.Mode != ModeRouter {
+		return node
+	}
+	var subnets []string
+	var seen = make(map[string]bool)
+	for _, subnet := range node.AllSubnets() {
+		switch {
+		case sameSubnet(subnet, cfg.Network):
+			subnet = hostSubnet(node.IP)
+		case sameSubnet(subnet, cfg.Network6):
+			subnet = hostSubnet(node.IP6)
+		}
+		if subnet == "" || seen[subnet] {
+			continue
+		}
+		seen[subnet] = true
+		subnets = append(subnets, subnet)
+	}
+	cp := *node
+	cp.setSubnets(subnets)
+	return &cp
+}
+
+func sameSubnet(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	netA, err := parseSubnet(a)
+	if err != nil {
+		return false
+	}
+	netB, err := parseSubnet(b)
+	if err != nil {
+		return false
+	}
+	return netA.String() == netB.String()
+}
+
+// check that routed subnets of node do not overlap with VPN network and subnets advertised by other nodes. Subnets
+// are informational in switch mode, so nothing is checked
+func (network *Network) checkOverlaps(config *Config, node *Node) error {
+	if config.Mode != ModeRouter {
+		return nil
+	}
+	var vpn []*net.IPNet
+	for _, cidr := range []string{config.Network, config.Network6} {
+		if cidr == "" {
+			continue
+		}
+		ipNet, err := parseSubnet(cidr)
+		if err != nil {
+			return err
+		}
+		vpn = append(vpn, ipNet)
+	}
+	// legacy nodes advertise whole network CIDR instead of own address
+	isLegacy := func(subnet *net.IPNet) bool {
+		for _, v := range vpn {
+			if v.String() == subnet.String() {
+				return true
+			}
+		}
+		return false
+	}
+	var routes []*net.IPNet
+	for _, route := range node.RoutedSubnets() {
+		ipNet, err := parseSubnet(route)
+		if err != nil {
+			return err
+		}
+		if isLegacy(ipNet) {
+			continue
+		}
+		for _, v := range vpn {
+			if overlaps(v, ipNet) {
+				return fmt.Errorf("subnet %s of node %s overlaps with VPN network %s", route, node.Name, v)
+			}
+		}
+		routes = append(routes, ipNet)
+	}
+	if len(routes) == 0 {
+		return nil
+	}
+	nodes, err := network.NodesDefinitions()
+	if err != nil {
+		return err
+	}
+	for _, other := range nodes {
+		if other.Name == node.Name {
+			continue
+		}
+		for _, subnet := range other.AllSubnets() {
+			ipNet, err := parseSubnet(subnet)
+			if err != nil || isLegacy(ipNet) {
+				continue
+			}
+			for _, route := range routes {
+				if overlaps(route, ipNet) {
+					return fmt.Errorf("subnet %s of node %s overlaps with subnet %s of node %s", route, node.Name, subnet, other.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// check that VPN addresses of node belongs to network-level CIDR
+func (cfg *Config) checkAddresses(node *Node) error {
+	for _, family := range []struct {
+		network string
+		ip      string
+	}{{cfg.Network, node.IP}, {cfg.Network6, node.IP6}} {
+		if family.network == "" || family.ip == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(family.network)
+		if err != nil {
+			return fmt.Errorf("parse network %s: %w", family.network, err)
+		}
+		if ip := net.ParseIP(family.ip); ip == nil || !ipNet.Contains(ip) {
+			return fmt.Errorf("%w for network (%s) and new node %s (%s)", ErrSubnetMismatch, family.network, node.Name, family.ip)
+		}
+	}
+	return nil
+}
+
+// VPN addresses of node with network masks, as assigned to the interface by tinc-up
+func (cfg *Config) InterfaceAddresses(node *Node) []*net.IPNet {
+	var ans []*net.IPNet
+	for _, family := range []struct {
+		ip   string
+		mask int
+		bits int
+	}{{node.IP, cfg.Mask, 32}, {node.IP6, cfg.Mask6, 128}} {
+		ip := net.ParseIP(family.ip)
+		if ip == nil {
+			continue
+		}
+		if v4 := ip.To4(); v4 != nil {
+			ip = v4
+		}
+		ans = append(ans, &net.IPNet{IP: ip, Mask: net.CIDRMask(family.mask, family.bits)})
+	}
+	return ans
+}
+
+// Route for subnet advertised by node (site-to-site), as added by subnet-up script: nil if route is not needed.
+// Routes are needed only in router mode and not for own subnets, VPN addresses and whole VPN network (routed by
+// interface address) and MAC addresses
+func (cfg *Config) RouteTo(node string, subnet string) *net.IPNet {
+	if cfg.Mode != ModeRouter || node == cfg.Name {
+		return nil
+	}
+	ipNet, err := parseSubnet(subnet)
+	if err != nil {
+		return nil // MAC address
+	}
+	for _, cidr := range []string{cfg.Network, cfg.Network6} {
+		if cidr == "" {
+			continue
+		}
+		if vpn, err := parseSubnet(cidr); err == nil && vpn.Contains(ipNet.IP) {
+			return nil
+		}
+	}
+	return ipNet
+}
+
+// Networks created before network-level CIDR was introduced advertise whole network CIDR as single subnet of each
+// node. Record it in configuration (Network). Self node is not changed: in switch mode the CIDR is still advertised
+// (see ownSubnets), switching to router mode (see Upgrade) replaces it by own address.
+func (network *Network) migrateLegacySubnet() error {
+	unlock, err := network.acquire()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	config, err := network.Read()
+	if err != nil {
+		return err
+	}
+	if config.Network != "" || config.Network6 != "" {
+		return nil
+	}
+	self, err := network.Node(config.Name)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(self.IP)
+	for _, subnet := range self.AllSubnets() {
+		_, ipNet, err := net.ParseCIDR(subnet)
+		if err != nil || ip == nil || !ipNet.Contains(ip) {
+			continue
+		}
+		config.Network = ipNet.String()
+		break
+	}
+	if config.Network == "" {
+		return nil
+	}
+	return network.update(config)
+}
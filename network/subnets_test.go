@@ -0,0 +1,289 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const fakePublicKey = "-----BEGIN RSA PUBLIC KEY-----\nXXX\n-----END RSA PUBLIC KEY-----"
+
+func TestNode_subnetsCompatibility(t *testing.T) {
+	node := &Node{Name: "alfa", Subnet: "10.10.1.2/32", Subnets: []string{"fd00::2/128", "192.168.0.0/24#10"}, IP: "10.10.1.2", Version: 3}
+	data, err := json.Marshal(node)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// node of previous version knows only single subnet
+	var legacy struct {
+		Subnet string `json:"subnet"`
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		t.Error(err)
+		return
+	}
+	if legacy.Subnet != "10.10.1.2/32" {
+		t.Errorf("unexpected subnet for previous version: %s", legacy.Subnet)
+	}
+
+	// host file contains all subnets as Subnet lines
+	text, err := node.Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if n := strings.Count(string(text), "Subnet = "); n != 3 {
+		t.Errorf("expected 3 subnet lines, got %d:\n%s", n, text)
+	}
+	var parsed Node
+	if err := parsed.Parse(text); err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(parsed.AllSubnets(), node.AllSubnets()) || parsed.Subnet != node.Subnet {
+		t.Errorf("unexpected parsed subnets: %v", parsed.AllSubnets())
+	}
+}
+
+func TestNetwork_migrateLegacySubnet(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+
+	ntw := &Network{Root: filepath.Join(tmp, "legacy")}
+	if err := ntw.Update(&Config{Name: "alfa", Mode: ModeSwitch, Mask: 16}); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := ntw.put(&Node{Name: "alfa", Subnet: "10.10.0.0/16", IP: "10.10.1.2", Version: 1}); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := ntw.migrateLegacySubnet(); err != nil {
+		t.Error(err)
+		return
+	}
+	self, config, err := ntw.SelfConfig()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if config.Network != "10.10.0.0/16" {
+		t.Errorf("network CIDR not migrated: %+v", config)
+	}
+	// nodes of previous versions accept only the same subnet
+	if self.Subnet != "10.10.0.0/16" || len(self.Subnets) != 0 || self.Version != 1 {
+		t.Errorf("self node should not be changed in switch mode: %+v", self)
+	}
+
+	if err := ntw.Upgrade(Upgrade{Subnets: []string{"192.168.2.0/24"}}); err == nil {
+		t.Error("routed subnets should be rejected in switch mode")
+	}
+
+	err = ntw.Put(&Node{Name: "beta", Subnet: "10.20.0.1/32", IP: "10.20.0.1", PublicKey: fakePublicKey, Version: 1})
+	if !errors.Is(err, ErrSubnetMismatch) {
+		t.Error("node outside of network should be rejected:", err)
+	}
+
+	// node of previous version advertises whole network: kept as is in switch mode
+	if err := ntw.Put(&Node{Name: "gamma", Subnet: "10.10.0.0/16", IP: "10.10.1.3", PublicKey: fakePublicKey, Version: 1}); err != nil {
+		t.Error(err)
+		return
+	}
+	gamma, err := ntw.Node("gamma")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if gamma.Subnet != "10.10.0.0/16" || len(gamma.Subnets) != 0 {
+		t.Errorf("legacy subnet should be kept in switch mode: %v", gamma.AllSubnets())
+	}
+
+	// explicit switch to router mode
+	if err := ntw.Upgrade(Upgrade{Mode: ModeRouter}); err != nil {
+		t.Error(err)
+		return
+	}
+	self, err = ntw.Self()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if self.Subnet != "10.10.1.2/32" || len(self.Subnets) != 0 || self.Version != 2 {
+		t.Errorf("self subnets not migrated: %+v", self)
+	}
+	if err := ntw.Put(&Node{Name: "delta", Subnet: "10.10.0.0/16", IP: "10.10.1.4", PublicKey: fakePublicKey, Version: 1}); err != nil {
+		t.Error(err)
+		return
+	}
+	delta, err := ntw.Node("delta")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if delta.Subnet != "10.10.1.4/32" || len(delta.Subnets) != 0 {
+		t.Errorf("legacy subnet not normalized in router mode: %v", delta.AllSubnets())
+	}
+}
+
+func TestNetwork_baselineCompatibility(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+
+	// network of previous version: no network CIDR in configuration, whole CIDR as subnet of self node
+	baseline := &Network{Root: filepath.Join(tmp, "baseline")}
+	if err := baseline.Update(&Config{Name: "alfa", Mode: ModeSwitch, Mask: 16, Broadcast: "mst"}); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := baseline.put(&Node{Name: "alfa", Subnet: "10.10.0.0/16", IP: "10.10.1.1", Version: 1}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// node of current version, migrated as by Prepare
+	current := &Network{Root: filepath.Join(tmp, "current")}
+	if err := current.Update(&Config{Name: "beta", Mode: ModeSwitch, Mask: 16, Broadcast: "mst"}); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := current.put(&Node{Name: "beta", Subnet: "10.10.0.0/16", IP: "10.10.1.2", PublicKey: fakePublicKey, Version: 1}); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := current.migrateLegacySubnet(); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := current.ReassignIP(); err != nil {
+		t.Error(err)
+		return
+	}
+	beta, err := current.Self()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := json.Marshal(beta)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// check of previous version: the same subnet as self node
+	var wire struct {
+		Subnet string `json:"subnet"`
+	}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		t.Error(err)
+		return
+	}
+	alfa, err := baseline.Self()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if wire.Subnet != alfa.Subnet {
+		t.Errorf("node of previous version will reject subnet %s (expected %s)", wire.Subnet, alfa.Subnet)
+	}
+
+	var imported Node
+	if err := json.Unmarshal(data, &imported); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := baseline.Put(&imported); err != nil {
+		t.Error(err)
+		return
+	}
+	if saved, err := baseline.Node("beta"); err != nil || saved.Subnet != "10.10.0.0/16" || saved.IP != beta.IP {
+		t.Errorf("unexpected imported node: %+v (%v)", saved, err)
+	}
+}
+
+func TestNetwork_checkOverlaps(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+
+	ntw := &Network{Root: filepath.Join(tmp, "routed")}
+	if err := ntw.Update(&Config{Name: "alfa", Mode: ModeRouter, Network: "10.10.0.0/16", Mask: 16}); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := ntw.put(&Node{Name: "alfa", Subnet: "10.10.1.1/32", IP: "10.10.1.1", Version: 1}); err != nil {
+		t.Error(err)
+		return
+	}
+	err = ntw.Put(&Node{Name: "beta", Subnet: "10.10.1.2/32", Subnets: []string{"192.168.1.0/24"}, IP: "10.10.1.2", PublicKey: fakePublicKey, Version: 1})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = ntw.Put(&Node{Name: "gamma", Subnet: "10.10.1.3/32", Subnets: []string{"192.168.0.0/16"}, IP: "10.10.1.3", PublicKey: fakePublicKey, Version: 1})
+	if err == nil {
+		t.Error("overlapped subnet should be rejected")
+	}
+	if err := ntw.Upgrade(Upgrade{Subnets: []string{"10.10.5.0/24"}}); err == nil {
+		t.Error("subnet inside VPN network should be rejected")
+	}
+	if err := ntw.Upgrade(Upgrade{Subnets: []string{"192.168.2.0/24"}}); err != nil {
+		t.Error(err)
+		return
+	}
+	self, err := ntw.Self()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if routes := self.RoutedSubnets(); len(routes) != 1 || routes[0] != "192.168.2.0/24" {
+		t.Errorf("unexpected routed subnets: %v", routes)
+	}
+}
+
+func TestConfig_RouteTo(t *testing.T) {
+	config := &Config{Name: "alfa", Mode: ModeRouter, Network: "10.10.0.0/16", Mask: 16}
+	for _, item := range []struct {
+		node   string
+		subnet string
+		route  string
+	}{
+		{"beta", "192.168.2.0/24#10", "192.168.2.0/24"},
+		{"beta", "192.168.2.7/32", "192.168.2.7/32"},
+		{"beta", "10.10.1.3/32", ""},
+		{"beta", "10.10.0.0/16", ""},
+		{"beta", "6e:6a:5e:26:39:d2", ""},
+		{"alfa", "192.168.1.0/24", ""},
+	} {
+		route := config.RouteTo(item.node, item.subnet)
+		if item.route == "" && route != nil || item.route != "" && (route == nil || route.String() != item.route) {
+			t.Errorf("unexpected route for %s of %s: %v", item.subnet, item.node, route)
+		}
+	}
+	switched := &Config{Name: "alfa", Mode: ModeSwitch, Network: "10.10.0.0/16", Mask: 16}
+	if route := switched.RouteTo("beta", "192.168.2.0/24"); route != nil {
+		t.Errorf("route %v should not be added in switch mode", route)
+	}
+
+	self := &Node{Name: "alfa", Subnet: "10.10.1.2/32", IP: "10.10.1.2", Version: 1}
+	addresses := config.InterfaceAddresses(self)
+	if len(addresses) != 1 || addresses[0].String() != "10.10.1.2/16" {
+		t.Errorf("unexpected addresses: %v", addresses)
+	}
+}
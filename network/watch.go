@@ -0,0 +1,60 @@
+package network
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+const watchDebounce = time.Second
+
+// Watch hosts directory for changes (new, removed or modified host files) made by this or other processes.
+// Bursts of changes are coalesced to single notification. Channel will be closed after context cancel.
+func (network *Network) WatchHosts(ctx context.Context) (<-chan struct{}, error) {
+	dir := (&DirStore{Root: network.Root}).hosts()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	raw, err := watchDir(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	var changes = make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-raw:
+				if !ok {
+					return
+				}
+			}
+			// wait till changes settle down
+			timer := time.NewTimer(watchDebounce)
+		DEBOUNCE:
+			for {
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case _, ok := <-raw:
+					if !ok {
+						timer.Stop()
+						return
+					}
+					timer.Reset(watchDebounce)
+				case <-timer.C:
+					break DEBOUNCE
+				}
+			}
+			select {
+			case changes <- struct{}{}:
+			default:
+				// previous notification not yet consumed
+			}
+		}
+	}()
+	return changes, nil
+}
@@ -0,0 +1,72 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// watch directory by inotify
+func watchDir(ctx context.Context, dir string) (<-chan struct{}, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	const mask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+	if _, err := syscall.InotifyAddWatch(fd, dir, mask); err != nil {
+		_ = syscall.Close(fd)
+		return nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+	// non-blocking descriptor is served by runtime poller, so Close interrupts pending Read
+	file := os.NewFile(uintptr(fd), "inotify")
+
+	var events = make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		_ = file.Close()
+	}()
+	go func() {
+		defer close(events)
+		var buffer [syscall.SizeofInotifyEvent * 128]byte
+		for {
+			n, err := file.Read(buffer[:])
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Println("watch", dir, ":", err)
+				}
+				return
+			}
+			if !hasVisibleChanges(buffer[:n]) {
+				continue
+			}
+			select {
+			case events <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// check that at least one event is not about hidden (temporary) file
+func hasVisibleChanges(data []byte) bool {
+	for offset := 0; offset+syscall.SizeofInotifyEvent <= len(data); {
+		event := (*syscall.InotifyEvent)(unsafe.Pointer(&data[offset]))
+		nameStart := offset + syscall.SizeofInotifyEvent
+		nameEnd := nameStart + int(event.Len)
+		if nameEnd > len(data) {
+			return true
+		}
+		name := string(bytes.TrimRight(data[nameStart:nameEnd], "\x00"))
+		if !strings.HasPrefix(name, ".") {
+			return true
+		}
+		offset = nameEnd
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+// +build !linux
+
+package network
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+)
+
+const watchPollInterval = 2 * time.Second
+
+// watch directory by polling modification time and size of files
+func watchDir(ctx context.Context, dir string) (<-chan struct{}, error) {
+	last, err := snapshotDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var events = make(chan struct{})
+	go func() {
+		defer close(events)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(watchPollInterval):
+			}
+			current, err := snapshotDir(dir)
+			if err != nil {
+				log.Println("watch", dir, ":", err)
+				continue
+			}
+			if current == last {
+				continue
+			}
+			last = current
+			select {
+			case events <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+func snapshotDir(dir string) (string, error) {
+	list, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	for _, item := range list {
+		if strings.HasPrefix(item.Name(), ".") {
+			continue
+		}
+		_, _ = fmt.Fprintf(&out, "%s %d %d\n", item.Name(), item.ModTime().UnixNano(), item.Size())
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,83 @@
+package network
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNetwork_WatchHosts(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	ntw := &Network{Root: tmp}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := ntw.WatchHosts(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	const (
+		timeout = 3 * watchDebounce
+		notify  = timeout + 2*time.Second // plus polling interval on platforms without inotify
+	)
+	// hidden (temporary) files are ignored
+	if err := ioutil.WriteFile(filepath.Join(tmp, "hosts", ".tmp"), []byte("Port = 1\n"), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+	select {
+	case <-changes:
+		t.Error("change of hidden file should not be notified")
+		return
+	case <-time.After(timeout):
+	}
+
+	// burst of changes is coalesced
+	for _, name := range []string{"alice", "bob", "charlie"} {
+		if err := ioutil.WriteFile(ntw.NodeFile(name), []byte("Port = 1\n"), 0644); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	select {
+	case <-changes:
+	case <-time.After(notify):
+		t.Error("change not notified")
+		return
+	}
+	select {
+	case <-changes:
+		t.Error("burst of changes should be notified once")
+		return
+	case <-time.After(timeout):
+	}
+
+	if err := os.Remove(ntw.NodeFile("bob")); err != nil {
+		t.Error(err)
+		return
+	}
+	select {
+	case <-changes:
+	case <-time.After(notify):
+		t.Error("removal not notified")
+		return
+	}
+
+	cancel()
+	select {
+	case _, ok := <-changes:
+		if ok {
+			t.Error("channel should be closed after cancel")
+		}
+	case <-time.After(timeout):
+		t.Error("channel not closed after cancel")
+	}
+}
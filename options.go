@@ -0,0 +1,43 @@
+package tincd
+
+import (
+	"github.com/tinc-boot/tincd/runner"
+	"github.com/tinc-boot/tincd/userspace"
+	"time"
+)
+
+// Optional parameter of running instance
+type Option func(impl *netImpl)
+
+// Run embedded DNS server on address (ex: 127.0.0.1:5353) which resolves <node>.<network> names to VPN addresses
+// of known nodes. See ResolverConfig to integrate it with system resolver.
+func WithDNS(address string) Option {
+	return func(impl *netImpl) {
+		impl.dnsAddress = address
+	}
+}
+
+// Terminate traffic of userspace network (multicast device, see network.Config.Userspace) by stack. Stack is also
+// used for tinc-boot protocol and by Dial/Listen. Without stack, userspace node could only relay traffic.
+// The library does not ship a stack: embedding application should adapt one (ex: gVisor netstack, which requires
+// newer Go than this module) to userspace.Stack, exchanging ethernet frames by Device.ReadFrame and WriteFrame.
+func WithStack(stack userspace.Stack) Option {
+	return func(impl *netImpl) {
+		impl.stack = stack
+	}
+}
+
+// Time for tincd to stop gracefully (run tinc-down and notify peers) before it will be killed.
+// Default is DefaultGracePeriod
+func WithGracePeriod(grace time.Duration) Option {
+	return func(impl *netImpl) {
+		impl.grace = grace
+	}
+}
+
+// Rotation and retention of tincd log (log.txt in network directory). Default is runner.DefaultLogPolicy
+func WithLogPolicy(policy runner.LogPolicy) Option {
+	return func(impl *netImpl) {
+		impl.logPolicy = policy
+	}
+}
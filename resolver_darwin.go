@@ -0,0 +1,15 @@
+package tincd
+
+import "net"
+
+// Resolver configuration (see resolver(5)) which forwards <node>.<network> queries to embedded DNS server
+// (see WithDNS). Returns suggested location and content.
+func ResolverConfig(networkName string, address string) (location string, content string) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = address, "53"
+	}
+	location = "/etc/resolver/" + networkName
+	content = "nameserver " + host + "\nport " + port + "\n"
+	return
+}
@@ -0,0 +1,9 @@
+package tincd
+
+// Drop-in configuration for systemd-resolved which forwards <node>.<network> queries to embedded DNS server
+// (see WithDNS). Non-standard port in address requires systemd 246+. Returns suggested location and content.
+func ResolverConfig(networkName string, address string) (location string, content string) {
+	location = "/etc/systemd/resolved.conf.d/tinc-" + networkName + ".conf"
+	content = "[Resolve]\nDNS=" + address + "\nDomains=~" + networkName + "\n"
+	return
+}
@@ -0,0 +1,14 @@
+package tincd
+
+import "net"
+
+// PowerShell command which adds NRPT rule to forward <node>.<network> queries to embedded DNS server
+// (see WithDNS). Windows resolver supports only standard port (53). Location is always empty.
+func ResolverConfig(networkName string, address string) (location string, content string) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	content = `Add-DnsClientNrptRule -Namespace ".` + networkName + `" -NameServers "` + host + `"`
+	return
+}
@@ -0,0 +1,242 @@
+package runner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// protocol of control socket (tinc 1.1)
+const (
+	controlID      = 0  // ID request
+	controlACK     = 4  // ACK reply
+	controlRequest = 18 // CONTROL request
+	controlVersion = 0  // TINC_CTL_VERSION_CURRENT
+
+	reqStop       = 0
+	reqReload     = 1
+	reqPurge      = 8
+	reqSetDebug   = 9
+	reqRetry      = 10
+	reqDisconnect = 12
+)
+
+const controlTimeout = 5 * time.Second
+
+// Operation is not supported by running tincd (ex: control socket required, but tinc 1.0 is used)
+var ErrNotSupported = errors.New("operation not supported by tincd")
+
+// Ask running tincd (by PID file) to reload configuration and host files (control socket or SIGHUP)
+func Reload(pidfile string) error {
+	if ctl, err := dialControl(pidfile); err == nil {
+		defer ctl.Close()
+		return ctl.call(reqReload)
+	}
+	pid, running := RunningInstance(pidfile)
+	if !running {
+		return fmt.Errorf("no running tincd instance for %s", pidfile)
+	}
+	return reloadProcess(pid)
+}
+
+// ask tincd to stop gracefully (as SIGTERM does) by control socket
+func stopByControl(pidfile string) error {
+	ctl, err := dialControl(pidfile)
+	if err != nil {
+		return err
+	}
+	defer ctl.Close()
+	return ctl.call(reqStop)
+}
+
+// Ask running tincd (by PID file) to purge information about unreachable nodes (control socket or SIGWINCH)
+func Purge(pidfile string) error {
+	if ctl, err := dialControl(pidfile); err == nil {
+		defer ctl.Close()
+		return ctl.call(reqPurge)
+	}
+	pid, running := RunningInstance(pidfile)
+	if !running {
+		return fmt.Errorf("no running tincd instance for %s", pidfile)
+	}
+	return purgeProcess(pid)
+}
+
+// Ask running tincd (by PID file) to retry outgoing connections immediately (control socket or SIGALRM)
+func Retry(pidfile string) error {
+	if ctl, err := dialControl(pidfile); err == nil {
+		defer ctl.Close()
+		return ctl.call(reqRetry)
+	}
+	pid, running := RunningInstance(pidfile)
+	if !running {
+		return fmt.Errorf("no running tincd instance for %s", pidfile)
+	}
+	return retryProcess(pid)
+}
+
+// Change debug level of running tincd (by PID file). Requires control socket (tinc 1.1).
+// Note: subnet events are parsed from output with debug level 3 and more.
+func SetDebugLevel(pidfile string, level int) error {
+	ctl, err := dialControl(pidfile)
+	if errors.Is(err, ErrPermissionDenied) {
+		return fmt.Errorf("set debug level: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("set debug level: %w", ErrNotSupported)
+	}
+	defer ctl.Close()
+	_, err = ctl.request(reqSetDebug, strconv.Itoa(level))
+	return err
+}
+
+// Close meta connection of running tincd (by PID file) with node. Requires control socket (tinc 1.1)
+func Disconnect(pidfile string, node string) error {
+	ctl, err := dialControl(pidfile)
+	if errors.Is(err, ErrPermissionDenied) {
+		return fmt.Errorf("disconnect: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("disconnect: %w", ErrNotSupported)
+	}
+	defer ctl.Close()
+	result, err := ctl.request(reqDisconnect, node)
+	if err != nil {
+		return err
+	}
+	if result != 0 {
+		return fmt.Errorf("node %s is not connected", node)
+	}
+	return nil
+}
+
+type controlConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// connect and authorize to control socket of tinc 1.1. PID file contains cookie, address of socket is UNIX socket
+// near PID file or TCP address from PID file (windows)
+func dialControl(pidfile string) (*controlConn, error) {
+	data, err := ioutil.ReadFile(pidfile)
+	if err != nil {
+		return nil, controlError(err)
+	}
+	// tinc 1.1: "<pid> <cookie> <host> port <port>"
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return nil, ErrNotSupported
+	}
+	cookie := fields[1]
+	var conn net.Conn
+	socket := controlSocket(pidfile)
+	if _, err := os.Stat(socket); err == nil {
+		conn, err = net.DialTimeout("unix", socket, controlTimeout)
+		if err != nil {
+			return nil, controlError(err)
+		}
+	} else if len(fields) == 5 {
+		conn, err = net.DialTimeout("tcp", net.JoinHostPort(fields[2], fields[4]), controlTimeout)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, ErrNotSupported
+	}
+	_ = conn.SetDeadline(time.Now().Add(controlTimeout))
+	ctl := &controlConn{conn: conn, reader: bufio.NewReader(conn)}
+	if err := ctl.handshake(cookie); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return ctl, nil
+}
+
+// socket and PID file of tincd started with administrative privileges may be inaccessible
+func controlError(err error) error {
+	if errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("%w: control socket: %v", ErrPermissionDenied, err)
+	}
+	return err
+}
+
+// same as tincd: .pid suffix replaced by .socket, otherwise .socket is appended
+func controlSocket(pidfile string) string {
+	return strings.TrimSuffix(pidfile, ".pid") + ".socket"
+}
+
+func (ctl *controlConn) handshake(cookie string) error {
+	if _, err := fmt.Fprintf(ctl.conn, "%d ^%s %d\n", controlID, cookie, controlVersion); err != nil {
+		return err
+	}
+	// server ID: "0 <name> <protocol>"
+	if _, err := ctl.line(controlID); err != nil {
+		return fmt.Errorf("control handshake: %w", err)
+	}
+	// acknowledge: "4 <version> <pid>"
+	if _, err := ctl.line(controlACK); err != nil {
+		return fmt.Errorf("control handshake: %w", err)
+	}
+	return nil
+}
+
+// send request and check that result is zero
+func (ctl *controlConn) call(code int) error {
+	result, err := ctl.request(code)
+	if err != nil {
+		return err
+	}
+	if result != 0 {
+		return fmt.Errorf("control request %d failed with code %d", code, result)
+	}
+	return nil
+}
+
+// send request and read result: "18 <code> <result>"
+func (ctl *controlConn) request(code int, args ...string) (int, error) {
+	request := strconv.Itoa(controlRequest) + " " + strconv.Itoa(code)
+	for _, arg := range args {
+		request += " " + arg
+	}
+	if _, err := fmt.Fprintln(ctl.conn, request); err != nil {
+		return 0, err
+	}
+	for {
+		fields, err := ctl.line(controlRequest)
+		if err != nil {
+			return 0, err
+		}
+		if len(fields) < 3 || fields[1] != strconv.Itoa(code) {
+			continue // unrelated message (ex: log)
+		}
+		return strconv.Atoi(fields[2])
+	}
+}
+
+// read line and check message type
+func (ctl *controlConn) line(expected int) ([]string, error) {
+	for {
+		line, err := ctl.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] != strconv.Itoa(expected) {
+			return nil, fmt.Errorf("unexpected control message: %s", strings.TrimSpace(line))
+		}
+		return fields, nil
+	}
+}
+
+func (ctl *controlConn) Close() error {
+	return ctl.conn.Close()
+}
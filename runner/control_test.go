@@ -0,0 +1,108 @@
+//+build linux darwin
+
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetDebugLevel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pidfile := filepath.Join(dir, "pid.run")
+	if err := ioutil.WriteFile(pidfile, []byte(fmt.Sprintf("%d secret 127.0.0.1 port 655\n", os.Getpid())), 0644); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("unix", controlSocket(pidfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	requests := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		id, _ := reader.ReadString('\n')
+		if strings.TrimSpace(id) != "0 ^secret 0" {
+			return
+		}
+		fmt.Fprintf(conn, "0 alice 17.7\n4 0 %d\n", os.Getpid())
+		request, _ := reader.ReadString('\n')
+		requests <- strings.TrimSpace(request)
+		fmt.Fprintln(conn, "18 9 4")
+	}()
+
+	if err := SetDebugLevel(pidfile, 2); err != nil {
+		t.Fatal(err)
+	}
+	if request := <-requests; request != "18 9 2" {
+		t.Error("unexpected request:", request)
+	}
+}
+
+func TestSetDebugLevel_unsupported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pidfile := filepath.Join(dir, "pid.run")
+	if err := ioutil.WriteFile(pidfile, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetDebugLevel(pidfile, 2); err == nil {
+		t.Error("tinc 1.0 should not support debug level")
+	}
+}
+
+func Test_stopByControl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pidfile := filepath.Join(dir, "pid.run")
+	if err := ioutil.WriteFile(pidfile, []byte(fmt.Sprintf("%d secret 127.0.0.1 port 655\n", os.Getpid())), 0644); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("unix", controlSocket(pidfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	requests := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		_, _ = reader.ReadString('\n')
+		fmt.Fprintf(conn, "0 alice 17.7\n4 0 %d\n", os.Getpid())
+		request, _ := reader.ReadString('\n')
+		requests <- strings.TrimSpace(request)
+		fmt.Fprintln(conn, "18 0 0")
+	}()
+
+	if err := stopByControl(pidfile); err != nil {
+		t.Fatal(err)
+	}
+	if request := <-requests; request != "18 0" {
+		t.Error("unexpected request:", request)
+	}
+}
@@ -0,0 +1,202 @@
+package runner
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// First argument of embedding binary started as privileged helper (see StartHelper and ServeHelper)
+const HelperCommand = "tinc-helper"
+
+const (
+	// How long to wait for helper socket (includes time for user to enter password)
+	HelperStartTimeout = 2 * time.Minute
+	// How long helper waits for tincd exit after requester asked to stop
+	HelperGracePeriod = time.Minute
+)
+
+var (
+	helperLock   sync.RWMutex
+	helperSocket string
+)
+
+// Parameters of privileged helper passed by command line (see StartHelper and IsHelperMode)
+type HelperConfig struct {
+	Socket string // unix socket for requests, accessible only by owner
+	Owner  int    // UID of unprivileged application
+	Tincd  string // tincd binary (name or path), resolved by helper on start
+}
+
+type helperRequest struct {
+	Command string `json:"command"`           // run or signal
+	Network string `json:"network,omitempty"` // absolute location of network directory (run)
+	Pid     int    `json:"pid,omitempty"`     // process started by helper (signal)
+	Signal  int    `json:"signal,omitempty"`  // signal number (signal)
+}
+
+type helperReply struct {
+	Error string `json:"error,omitempty"`
+	Pid   int    `json:"pid,omitempty"`
+}
+
+// Start privileged helper: current executable is started once with administrative privileges as
+// `<executable> tinc-helper <socket> <uid> <tincd>`, so embedding application should call ServeHelper in this case
+// (see IsHelperMode). After start, RunTinc with sudo and signals to tincd go through the helper, so multiple
+// networks need only one prompt. Helper is stopped with context.
+//
+// Helper runs only tincd binary resolved on its start (tincBin of RunTinc is ignored) with fixed arguments for
+// network directory. Nevertheless, tincd runs scripts (tinc-up, host-up, ...) from the network directory as root, so
+// any process of the same user which could write to network directory effectively gains administrative privileges
+// while helper is running.
+//
+// Helper has no separate commands for TAP devices and scripts: tincd started by helper creates the device and runs
+// scripts as root, so no other prompt is needed for them. Not covered by helper: native interface configuration
+// (network.Config.NativeInterface), which is done by the library process and requires its own CAP_NET_ADMIN, and
+// Windows, where helper is not supported.
+func StartHelper(ctx context.Context, socket string, tincBin string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	socket, err = filepath.Abs(socket)
+	if err != nil {
+		return err
+	}
+	_ = os.Remove(socket)
+	args := withSudo([]string{executable, HelperCommand, socket, strconv.Itoa(os.Getuid()), tincBin})
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start helper: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+		helperLock.Lock()
+		defer helperLock.Unlock()
+		if helperSocket == socket {
+			helperSocket = ""
+		}
+	}()
+	timeout := time.After(HelperStartTimeout)
+	for {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			_ = conn.Close()
+			break
+		}
+		select {
+		case err := <-exited:
+			return fmt.Errorf("helper exited: %v", err)
+		case <-timeout:
+			return fmt.Errorf("helper socket %s not created in %v", socket, HelperStartTimeout)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	helperLock.Lock()
+	defer helperLock.Unlock()
+	helperSocket = socket
+	return nil
+}
+
+// Detect helper mode by command line arguments without program name (os.Args[1:])
+func IsHelperMode(args []string) (*HelperConfig, bool) {
+	if len(args) != 4 || args[0] != HelperCommand {
+		return nil, false
+	}
+	uid, err := strconv.Atoi(args[2])
+	if err != nil {
+		return nil, false
+	}
+	return &HelperConfig{Socket: args[1], Owner: uid, Tincd: args[3]}, true
+}
+
+// Check that privileged helper was started by this process and is still running (see StartHelper)
+func IsHelperStarted() bool {
+	return currentHelper() != ""
+}
+
+func currentHelper() string {
+	helperLock.RLock()
+	defer helperLock.RUnlock()
+	return helperSocket
+}
+
+// run tincd for network directory by helper and copy output until process exit. Process is stopped gracefully when
+// context canceled (half-closed connection) and killed when kill context is done (closed connection)
+func runByHelper(ctx context.Context, kill context.Context, socket string, dir string, output io.Writer) error {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return fmt.Errorf("connect helper: %w", err)
+	}
+	defer conn.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		if unix, ok := conn.(*net.UnixConn); ok {
+			_ = unix.CloseWrite()
+		} else {
+			_ = conn.Close()
+		}
+		select {
+		case <-kill.Done():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+	reader, err := callHelper(conn, &helperRequest{Command: "run", Network: dir})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(output, reader)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// send signal to process started by helper
+func signalByHelper(socket string, pid int, signal int) error {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return fmt.Errorf("connect helper: %w", err)
+	}
+	defer conn.Close()
+	_, err = callHelper(conn, &helperRequest{Command: "signal", Pid: pid, Signal: signal})
+	return err
+}
+
+func callHelper(conn net.Conn, request *helperRequest) (*bufio.Reader, error) {
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return nil, fmt.Errorf("send request to helper: %w", err)
+	}
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("read reply from helper: %w", err)
+	}
+	var reply helperReply
+	if err := json.Unmarshal(line, &reply); err != nil {
+		return nil, fmt.Errorf("parse reply from helper: %w", err)
+	}
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+	return reader, nil
+}
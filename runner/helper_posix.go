@@ -0,0 +1,235 @@
+//+build linux darwin
+
+package runner
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/tinc-boot/tincd/utils"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Serve privileged helper requests on unix socket until context canceled. Socket is accessible only by owner (UID
+// of unprivileged application). Only tincd binary (resolved once on start) could be started, and only for network
+// directory; only processes started by helper could be signaled. Processes are killed after disconnect of requester
+// or when context canceled.
+func ServeHelper(ctx context.Context, config HelperConfig) error {
+	tincd, err := exec.LookPath(config.Tincd)
+	if err != nil {
+		return fmt.Errorf("resolve tincd: %w", err)
+	}
+	if !isTincd(filepath.Base(tincd)) {
+		return fmt.Errorf("%s is not tincd", tincd)
+	}
+	tincd, err = filepath.Abs(tincd)
+	if err != nil {
+		return err
+	}
+	socket, owner := config.Socket, config.Owner
+	_ = os.Remove(socket)
+	mask := syscall.Umask(0177)
+	listener, err := net.Listen("unix", socket)
+	syscall.Umask(mask)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	if err := os.Chown(socket, owner, -1); err != nil {
+		return fmt.Errorf("change owner of %s: %w", socket, err)
+	}
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+	srv := &helperServer{tincd: tincd, processes: make(map[int]bool)}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			srv.serve(ctx, conn)
+		}()
+	}
+}
+
+type helperServer struct {
+	tincd     string
+	lock      sync.Mutex
+	processes map[int]bool
+}
+
+func (srv *helperServer) serve(ctx context.Context, conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return
+	}
+	var request helperRequest
+	if err := json.Unmarshal(line, &request); err != nil {
+		replyHelper(conn, &helperReply{Error: "invalid request: " + err.Error()})
+		return
+	}
+	switch request.Command {
+	case "run":
+		srv.run(ctx, conn, reader, &request)
+	case "signal":
+		srv.signal(conn, &request)
+	default:
+		replyHelper(conn, &helperReply{Error: "unknown command " + request.Command})
+	}
+}
+
+func (srv *helperServer) run(ctx context.Context, conn net.Conn, requester io.Reader, request *helperRequest) {
+	dir, err := networkDir(request.Network)
+	if err != nil {
+		replyHelper(conn, &helperReply{Error: err.Error()})
+		return
+	}
+	output, input, err := os.Pipe()
+	if err != nil {
+		replyHelper(conn, &helperReply{Error: err.Error()})
+		return
+	}
+	defer output.Close()
+	args := makeArgs(srv.tincd, dir)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Stdout = input
+	cmd.Stderr = input
+	utils.SetCmdAttrs(cmd)
+	err = cmd.Start()
+	_ = input.Close()
+	if err != nil {
+		replyHelper(conn, &helperReply{Error: err.Error()})
+		return
+	}
+	pid := cmd.Process.Pid
+	srv.track(pid, true)
+	defer srv.track(pid, false)
+	log.Println("helper: started tincd", pid, "for", dir)
+
+	replyHelper(conn, &helperReply{Pid: pid})
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	stopped := make(chan struct{}) // requester half-closed (or closed) connection
+	go func() {
+		defer close(stopped)
+		_, _ = io.Copy(ioutil.Discard, requester)
+	}()
+	delivered := make(chan struct{}) // output could not be delivered (requester closed connection) or process exited
+	go func() {
+		defer close(delivered)
+		_, _ = io.Copy(conn, output)
+	}()
+	broken := (<-chan struct{})(delivered)
+
+	var force <-chan time.Time
+	kill := func() {
+		if err := syscall.Kill(-pid, syscall.SIGKILL); err != nil {
+			_ = cmd.Process.Kill()
+		}
+	}
+	for {
+		select {
+		case err := <-exited:
+			<-delivered
+			log.Println("helper: tincd", pid, "stopped:", err)
+			return
+		case <-stopped:
+			stopped = nil
+			if err := syscall.Kill(-pid, syscall.SIGTERM); err != nil {
+				_ = cmd.Process.Signal(syscall.SIGTERM)
+			}
+			force = time.After(HelperGracePeriod)
+		case <-broken:
+			broken = nil
+			kill()
+		case <-force:
+			kill()
+		case <-ctx.Done():
+			kill()
+		}
+	}
+}
+
+// check that requested location is network directory: absolute path of directory with tinc.conf
+func networkDir(dir string) (string, error) {
+	if dir == "" || !filepath.IsAbs(dir) || filepath.Clean(dir) != dir {
+		return "", fmt.Errorf("network directory %q should be clean absolute path", dir)
+	}
+	if stat, err := os.Stat(dir); err != nil {
+		return "", err
+	} else if !stat.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+	if stat, err := os.Stat(filepath.Join(dir, "tinc.conf")); err != nil {
+		return "", fmt.Errorf("%s is not a network directory: %w", dir, err)
+	} else if !stat.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a network directory: tinc.conf is not a file", dir)
+	}
+	return dir, nil
+}
+
+func (srv *helperServer) signal(conn net.Conn, request *helperRequest) {
+	srv.lock.Lock()
+	known := srv.processes[request.Pid]
+	srv.lock.Unlock()
+	if !known {
+		replyHelper(conn, &helperReply{Error: fmt.Sprintf("process %d is not started by helper", request.Pid)})
+		return
+	}
+	if err := syscall.Kill(request.Pid, syscall.Signal(request.Signal)); err != nil {
+		replyHelper(conn, &helperReply{Error: err.Error()})
+		return
+	}
+	replyHelper(conn, &helperReply{Pid: request.Pid})
+}
+
+func (srv *helperServer) track(pid int, running bool) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	if running {
+		srv.processes[pid] = true
+	} else {
+		delete(srv.processes, pid)
+	}
+}
+
+func replyHelper(conn net.Conn, reply *helperReply) {
+	_ = json.NewEncoder(conn).Encode(reply)
+}
+
+// send signal directly or by helper if process owned by another user (ex: root)
+func signalProcess(pid int, signal syscall.Signal) error {
+	err := syscall.Kill(pid, signal)
+	if err == syscall.EPERM {
+		if socket := currentHelper(); socket != "" {
+			return signalByHelper(socket, pid, int(signal))
+		}
+		return fmt.Errorf("%w: tincd %d is owned by another user, privileged helper is not started (see StartHelper)", ErrPermissionDenied, pid)
+	}
+	return err
+}
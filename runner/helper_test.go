@@ -0,0 +1,81 @@
+//+build linux darwin
+
+package runner
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestServeHelper(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	fake := filepath.Join(tmp, "tincd")
+	err = ioutil.WriteFile(fake, []byte("#!/bin/sh\ntrap 'echo stopping; exit 0' TERM\necho started $@\nwhile true; do sleep 0.1; done\n"), 0755)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	socket := filepath.Join(tmp, "helper.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := ServeHelper(ctx, HelperConfig{Socket: socket, Owner: os.Getuid(), Tincd: "/bin/sh"}); err == nil {
+		t.Error("non-tincd binary accepted")
+	}
+	go func() {
+		_ = ServeHelper(ctx, HelperConfig{Socket: socket, Owner: os.Getuid(), Tincd: fake})
+	}()
+	for i := 0; i < 50; i++ {
+		if _, err := os.Stat(socket); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ntw := filepath.Join(tmp, "alfa")
+	if err := os.MkdirAll(ntw, 0755); err != nil {
+		t.Error(err)
+		return
+	}
+	for _, dir := range []string{"alfa", ntw + "/../alfa", ntw} {
+		if err := runByHelper(ctx, ctx, socket, dir, ioutil.Discard); err == nil {
+			t.Error("started for invalid network directory", dir)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(ntw, "tinc.conf"), []byte("Name = alfa\n"), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var output bytes.Buffer
+	run, stop := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- runByHelper(run, ctx, socket, ntw, &output)
+	}()
+	time.Sleep(300 * time.Millisecond)
+	if err := signalByHelper(socket, os.Getpid(), int(syscall.SIGHUP)); err == nil {
+		t.Error("signal to unknown process accepted")
+	}
+	stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("process not stopped after disconnect")
+	}
+	// stopped gracefully
+	if !strings.Contains(output.String(), "-c "+ntw) || !strings.Contains(output.String(), "stopping") {
+		t.Errorf("unexpected output: %s", output.String())
+	}
+}
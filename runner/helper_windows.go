@@ -0,0 +1,11 @@
+package runner
+
+import (
+	"context"
+	"errors"
+)
+
+// Privileged helper is not supported on windows
+func ServeHelper(ctx context.Context, config HelperConfig) error {
+	return errors.New("privileged helper is not supported on windows")
+}
@@ -3,6 +3,8 @@ package runner
 import (
 	"bufio"
 	"context"
+	"errors"
+	"fmt"
 	"github.com/tinc-boot/tincd/utils"
 	"io"
 	"log"
@@ -10,14 +12,31 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
 )
 
 var (
 	addSubnetPattern = regexp.MustCompile(`ADD_SUBNET\s+from\s+([^\s]+)\s+\(([^\s]+)\s+port\s+(\d+)\)\:\s+\d+\s+[\w\d]+\s+([^\s]+)\s+([^#]+)`)
 	delSubnetPattern = regexp.MustCompile(`DEL_SUBNET\s+[^:]+:\s+\d+\s+[\w\d]+\s+([^\s]+)\s+([^#]+)`)
+	pathMTUPattern   = regexp.MustCompile(`([^\s]+)\s+at\s+[^\s]+.*\s+pmtu\s+(\d+)\s+\(min\s+(\d+)\s+max\s+(\d+)\)`)
 )
 
-//Sending DEL_SUBNET to everyone (BROADCAST): 11 3f17d1ce hubreddecnet_PEN005 6e:6a:5e:26:39:d2#10
+// node line of nodes dump (SIGUSR2):
+// hubreddecnet_PEN005 at 10.0.0.5 port 655 cipher 427 digest 64 maclength 4 compression 0 options 700000c status 0012 nexthop hubreddecnet_PEN005 via hubreddecnet_PEN005 pmtu 1451 (min 1451 max 1451)
+func pathMTUFromLine(line string) *PathMTUEvent {
+	match := pathMTUPattern.FindStringSubmatch(line)
+	if len(match) != 5 {
+		return nil
+	}
+	var event = PathMTUEvent{Node: match[1]}
+	event.PMTU, _ = strconv.Atoi(match[2])
+	event.MinMTU, _ = strconv.Atoi(match[3])
+	event.MaxMTU, _ = strconv.Atoi(match[4])
+	return &event
+}
+
+// Sending DEL_SUBNET to everyone (BROADCAST): 11 3f17d1ce hubreddecnet_PEN005 6e:6a:5e:26:39:d2#10
 func fromLine(line string) *SubnetEvent {
 	if match := addSubnetPattern.FindAllStringSubmatch(line, -1); len(match) > 0 {
 		groups := match[0]
@@ -46,6 +65,20 @@ func fromLine(line string) *SubnetEvent {
 	return nil
 }
 
+// Event from tincd output. Only one field is set
+type Event struct {
+	Subnet  *SubnetEvent
+	PathMTU *PathMTUEvent
+}
+
+// Discovered path MTU to node
+type PathMTUEvent struct {
+	Node   string
+	PMTU   int
+	MinMTU int
+	MaxMTU int
+}
+
 type SubnetEvent struct {
 	Add         bool
 	Advertising struct {
@@ -61,67 +94,172 @@ type SubnetEvent struct {
 
 func makeArgs(tincBin string, dir string) []string {
 	return []string{tincBin, "-D", "-d", "-d", "-d", "-d",
-		"--pidfile", filepath.Join(dir, "pid.run"),
+		"--pidfile", pidfile(dir),
 		"-c", dir}
 }
 
-// Run tinc application and scan output for events
-func RunTinc(global context.Context, askSudo bool, tincBin string, dir string) <-chan SubnetEvent {
+// PID file of tincd in network directory
+func pidfile(dir string) string {
+	return filepath.Join(dir, "pid.run")
+}
+
+// Failed start of tincd: binary not found, permission denied or administrative privileges not granted
+type StartError struct {
+	Args []string // command line
+	Err  error    // cause (ErrBinaryNotFound, ErrPermissionDenied, ErrSudoCancelled or other)
+}
 
-	var events = make(chan SubnetEvent)
+func (se *StartError) Error() string {
+	return fmt.Sprintf("start tincd (%s): %v", strings.Join(se.Args, " "), se.Err)
+}
+
+func (se *StartError) Unwrap() error {
+	return se.Err
+}
+
+// Causes of StartError. ErrPermissionDenied and ErrSudoCancelled also match ErrPrivilegeDenied (see errors.Is)
+var (
+	ErrBinaryNotFound   = errors.New("binary not found")
+	ErrPermissionDenied = &privilegeError{message: "permission denied"}
+	ErrSudoCancelled    = &privilegeError{message: "administrative privileges not granted"}
+)
+
+// Not enough privileges: permission denied or administrative privileges not granted
+var ErrPrivilegeDenied = errors.New("not enough privileges")
+
+type privilegeError struct {
+	message string
+}
+
+func (pe *privilegeError) Error() string { return pe.message }
+
+func (pe *privilegeError) Is(target error) bool { return target == ErrPrivilegeDenied }
+
+// messages of sudo wrappers when privileges are not granted (osascript, sudo, pkexec, gksu)
+var sudoDeniedPattern = regexp.MustCompile(`(?i)user cancell?ed|incorrect password|no tty present|a terminal is required|not authorized|authentication failure`)
+
+// Running tincd
+type Process struct {
+	events <-chan Event
+	err    error
+}
+
+// Events from tincd output. Channel is closed after process exit
+func (proc *Process) Events() <-chan Event {
+	return proc.events
+}
+
+// Exit error of process (available after events channel is closed). StartError if privileges were not granted
+func (proc *Process) Err() error {
+	return proc.err
+}
+
+// Run tinc application and scan output for events. When global context is done, tincd is asked to stop gracefully
+// (SIGTERM: runs tinc-down and notifies peers). When kill context is done, tincd is killed. Output of tincd is
+// copied to log (see OpenLog). Returns StartError if process could not be started. With sudo and started helper
+// (see StartHelper), tincd is run by the helper: tincBin is ignored, binary of the helper is used.
+func RunTinc(global context.Context, kill context.Context, askSudo bool, tincBin string, dir string, logfile io.Writer) (*Process, error) {
+
+	var events = make(chan Event)
+	var proc = &Process{events: events}
 
 	reader, writer := io.Pipe()
 	scanner := bufio.NewScanner(reader)
 	args := makeArgs(tincBin, dir)
-	if askSudo {
+	helper := currentHelper()
+	sudo := askSudo && helper == ""
+	if sudo {
 		args = withSudo(args)
 	}
-
-	logfile, err := os.Create(filepath.Join(dir, "log.txt"))
-	if err != nil {
-		panic(err)
-	}
-
-	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Dir = dir
-	cmd.Stderr = io.MultiWriter(writer, logfile)
-	utils.SetCmdAttrs(cmd)
-	cmd.Stdout = io.MultiWriter(writer, logfile)
+	var exitErr error // set before writer closed
 
 	child, cancel := context.WithCancel(global)
-	go func() {
-		// kill process when context canceled
-		defer cancel()
-		<-child.Done()
-		killProcess(cmd)
-	}()
+	if askSudo && helper != "" {
+		go func() {
+			// run process by privileged helper (killed after disconnect), cancel context after
+			defer writer.Close()
+			defer cancel()
+			exitErr = runByHelper(child, kill, helper, dir, io.MultiWriter(writer, logfile))
+			if exitErr != nil {
+				log.Println("run tincd by helper:", exitErr)
+			}
+		}()
+	} else {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = dir
+		cmd.Stderr = io.MultiWriter(writer, logfile)
+		utils.SetCmdAttrs(cmd)
+		cmd.Stdout = io.MultiWriter(writer, logfile)
 
-	go func() {
-		// run process, cancel context after
-		defer writer.Close()
-		defer logfile.Close()
-		defer cancel()
-		err := cmd.Run()
-		if err != nil {
-			log.Println("run tincd:", err)
+		if err := cmd.Start(); err != nil {
+			cancel()
+			return nil, &StartError{Args: args, Err: startCause(err)}
 		}
+		exited := make(chan struct{})
+		go func() {
+			// stop process when context canceled and kill it when kill context done
+			defer cancel()
+			<-child.Done()
+			terminateProcess(cmd, pidfile(dir))
+			select {
+			case <-kill.Done():
+				killProcess(cmd)
+			case <-exited:
+			}
+		}()
 
-	}()
+		go func() {
+			// wait for process, cancel context after
+			defer writer.Close()
+			defer cancel()
+			defer close(exited)
+			exitErr = cmd.Wait()
+			if exitErr != nil {
+				log.Println("run tincd:", exitErr)
+			}
+		}()
+	}
 
 	go func() {
 		// read events from stdout, stderr
 		defer close(events)
 		defer cancel()
+		var denied bool
 		for scanner.Scan() {
-			if event := fromLine(scanner.Text()); event != nil {
-				select {
-				case events <- *event:
-				case <-global.Done():
-					return
-				}
+			if sudo && sudoDeniedPattern.MatchString(scanner.Text()) {
+				denied = true
 			}
+			var event Event
+			if subnet := fromLine(scanner.Text()); subnet != nil {
+				event.Subnet = subnet
+			} else if pmtu := pathMTUFromLine(scanner.Text()); pmtu != nil {
+				event.PathMTU = pmtu
+			} else {
+				continue
+			}
+			select {
+			case events <- event:
+			case <-global.Done():
+				// keep reading output until exit, otherwise stopping process will be blocked on write
+			}
+		}
+		if denied && exitErr != nil {
+			proc.err = &StartError{Args: args, Err: ErrSudoCancelled}
+		} else {
+			proc.err = exitErr
 		}
 	}()
 
-	return events
+	return proc, nil
+}
+
+func startCause(err error) error {
+	switch {
+	case errors.Is(err, exec.ErrNotFound), os.IsNotExist(err):
+		return fmt.Errorf("%w: %v", ErrBinaryNotFound, err)
+	case os.IsPermission(err):
+		return fmt.Errorf("%w: %v", ErrPermissionDenied, err)
+	default:
+		return err
+	}
 }
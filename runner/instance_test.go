@@ -0,0 +1,81 @@
+//+build linux darwin
+
+package runner
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunTinc_gracefulStop(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	fake := filepath.Join(tmp, "tincd")
+	err = ioutil.WriteFile(fake, []byte("#!/bin/sh\ntrap 'echo stopping; exit 0' TERM\nwhile true; do sleep 0.1; done\n"), 0755)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	logfile, err := OpenLog(filepath.Join(tmp, LogFileName), DefaultLogPolicy)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer logfile.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	kill, forceKill := context.WithCancel(context.Background())
+	defer forceKill()
+	proc, err := RunTinc(ctx, kill, false, fake, tmp, logfile)
+	if err != nil {
+		cancel()
+		t.Error(err)
+		return
+	}
+	events := proc.Events()
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("unexpected event")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("process not stopped")
+		return
+	}
+	if tail := strings.Join(logfile.Tail(0), "\n"); !strings.Contains(tail, "stopping") {
+		t.Errorf("unexpected tail: %s", tail)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(tmp, LogFileName))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !strings.Contains(string(data), "stopping") {
+		t.Errorf("process not stopped gracefully: %s", data)
+	}
+}
+
+func TestRunTinc_notFound(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	_, err = RunTinc(context.Background(), context.Background(), false, filepath.Join(tmp, "tincd"), tmp, ioutil.Discard)
+	var startErr *StartError
+	if !errors.As(err, &startErr) || !errors.Is(err, ErrBinaryNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -8,7 +8,42 @@ import (
 )
 
 func killProcess(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
 	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
 		_ = cmd.Process.Kill()
 	}
 }
+
+// ask tincd to stop gracefully (SIGTERM to process group)
+func terminateProcess(cmd *exec.Cmd, pidfile string) {
+	if cmd.Process == nil {
+		return
+	}
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM); err != nil {
+		_ = cmd.Process.Signal(syscall.SIGTERM)
+	}
+}
+
+func isProcessAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	// EPERM: process exists, but owned by another user (ex: root for sudo)
+	return err == nil || err == syscall.EPERM
+}
+
+func reloadProcess(pid int) error {
+	return signalProcess(pid, syscall.SIGHUP)
+}
+
+func dumpProcess(pid int) error {
+	return signalProcess(pid, syscall.SIGUSR2)
+}
+
+func purgeProcess(pid int) error {
+	return signalProcess(pid, syscall.SIGWINCH)
+}
+
+func retryProcess(pid int) error {
+	return signalProcess(pid, syscall.SIGALRM)
+}
@@ -1,9 +1,73 @@
 package runner
 
 import (
+	"errors"
+	"log"
 	"os/exec"
+	"syscall"
+)
+
+const (
+	stillActive    = 259
+	ctrlBreakEvent = 1
+)
+
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procGenerateConsoleCtrlEvent = kernel32.NewProc("GenerateConsoleCtrlEvent")
 )
 
 func killProcess(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
 	_ = cmd.Process.Kill()
 }
+
+// ask tincd to stop gracefully: by control socket (tinc 1.1) or by CTRL_BREAK_EVENT to its process group (works if
+// console is shared). Without both tincd is killed immediately: there is no signal to wait for
+func terminateProcess(cmd *exec.Cmd, pidfile string) {
+	if cmd.Process == nil {
+		return
+	}
+	err := stopByControl(pidfile)
+	if err == nil {
+		return
+	}
+	r, _, callErr := procGenerateConsoleCtrlEvent.Call(ctrlBreakEvent, uintptr(cmd.Process.Pid))
+	if r != 0 {
+		return
+	}
+	log.Println("no graceful stop for tincd", cmd.Process.Pid, ":", err, "and", callErr, "- killing")
+	killProcess(cmd)
+}
+
+func isProcessAlive(pid int) bool {
+	handle, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		// access denied means process exists
+		return err == syscall.ERROR_ACCESS_DENIED
+	}
+	defer syscall.CloseHandle(handle)
+	var code uint32
+	if err := syscall.GetExitCodeProcess(handle, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
+
+func reloadProcess(pid int) error {
+	return errors.New("reload without control socket is not supported on windows")
+}
+
+func dumpProcess(pid int) error {
+	return errors.New("dump is not supported on windows")
+}
+
+func purgeProcess(pid int) error {
+	return errors.New("purge without control socket is not supported on windows")
+}
+
+func retryProcess(pid int) error {
+	return errors.New("retry without control socket is not supported on windows")
+}
@@ -0,0 +1,200 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Name of tincd log file in network directory
+const LogFileName = "log.txt"
+
+// Rotation and retention of tincd log
+type LogPolicy struct {
+	MaxSize    int64         // rotate log when it exceeds size in bytes (0 - no limit)
+	MaxAge     time.Duration // rotate log when it is older (0 - no limit)
+	MaxBackups int           // number of rotated logs to keep: log.txt.1 (previous), log.txt.2, ...
+	TailLines  int           // number of recent lines kept in memory (see LogFile.Tail)
+}
+
+// Default log policy: 10MB or one day per file, 5 rotated files, 1000 lines in memory
+var DefaultLogPolicy = LogPolicy{
+	MaxSize:    10 * 1024 * 1024,
+	MaxAge:     24 * time.Hour,
+	MaxBackups: 5,
+	TailLines:  1000,
+}
+
+// Log file with rotation and in-memory tail of recent lines. Goroutine safe
+type LogFile struct {
+	filename string
+	policy   LogPolicy
+	lock     sync.Mutex
+	file     *os.File
+	size     int64
+	opened   time.Time
+	lines    []string // ring buffer
+	next     int      // position of next line in ring buffer
+	full     bool     // ring buffer wrapped
+	partial  []byte   // incomplete last line
+}
+
+// Open log file. Existing log (previous run) is rotated
+func OpenLog(filename string, policy LogPolicy) (*LogFile, error) {
+	lf := &LogFile{filename: filename, policy: policy}
+	if policy.TailLines > 0 {
+		lf.lines = make([]string, policy.TailLines)
+	}
+	if stat, err := os.Stat(filename); err == nil && stat.Size() > 0 {
+		if err := lf.rotate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+// Write data to log file and remember complete lines in tail. Never fails, so log could be used in io.MultiWriter
+// with tincd output: failed rotation is logged and writing continues to current file, failed writes (ex: disk is
+// full) and writes after Close are dropped.
+func (lf *LogFile) Write(data []byte) (int, error) {
+	lf.lock.Lock()
+	defer lf.lock.Unlock()
+	lf.remember(data)
+	if lf.file == nil {
+		return len(data), nil
+	}
+	if lf.needRotate(len(data)) {
+		lf.rotateFile()
+	}
+	if lf.file == nil {
+		return len(data), nil
+	}
+	n, _ := lf.file.Write(data)
+	lf.size += int64(n)
+	return len(data), nil
+}
+
+// Last n lines of log (all kept lines if n <= 0) from memory, oldest first
+func (lf *LogFile) Tail(n int) []string {
+	lf.lock.Lock()
+	defer lf.lock.Unlock()
+	count := lf.next
+	if lf.full {
+		count = len(lf.lines)
+	}
+	if n <= 0 || n > count {
+		n = count
+	}
+	var ans = make([]string, 0, n)
+	for i := count - n; i < count; i++ {
+		ans = append(ans, lf.lines[(lf.next-count+i+len(lf.lines))%len(lf.lines)])
+	}
+	return ans
+}
+
+// Name of log file
+func (lf *LogFile) Name() string {
+	return lf.filename
+}
+
+// Close log file. Tail is still available
+func (lf *LogFile) Close() error {
+	lf.lock.Lock()
+	defer lf.lock.Unlock()
+	if lf.file == nil {
+		return nil
+	}
+	err := lf.file.Close()
+	lf.file = nil
+	return err
+}
+
+func (lf *LogFile) needRotate(size int) bool {
+	if lf.policy.MaxSize > 0 && lf.size > 0 && lf.size+int64(size) > lf.policy.MaxSize {
+		return true
+	}
+	return lf.policy.MaxAge > 0 && time.Since(lf.opened) > lf.policy.MaxAge
+}
+
+func (lf *LogFile) open() error {
+	file, err := os.Create(lf.filename)
+	if err != nil {
+		return fmt.Errorf("create log file: %w", err)
+	}
+	lf.file = file
+	lf.size = 0
+	lf.opened = time.Now()
+	return nil
+}
+
+// rotate and re-create log file. On failure current file is re-opened for append and the next attempt is postponed
+// till the next rotation period
+func (lf *LogFile) rotateFile() {
+	_ = lf.file.Close()
+	lf.file = nil
+	err := lf.rotate()
+	if err == nil {
+		err = lf.open()
+	}
+	if err == nil {
+		return
+	}
+	log.Println("rotate", lf.filename, ":", err)
+	file, err := os.OpenFile(lf.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		log.Println("re-open", lf.filename, ":", err)
+		return
+	}
+	lf.file = file
+	lf.size = 0
+	lf.opened = time.Now()
+}
+
+// shift rotated logs (log.txt.1 -> log.txt.2, ...), drop the oldest and move current log to log.txt.1
+func (lf *LogFile) rotate() error {
+	if lf.policy.MaxBackups <= 0 {
+		return nil // will be truncated
+	}
+	_ = os.Remove(lf.backup(lf.policy.MaxBackups))
+	for i := lf.policy.MaxBackups - 1; i > 0; i-- {
+		if err := os.Rename(lf.backup(i), lf.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("rotate log: %w", err)
+		}
+	}
+	if err := os.Rename(lf.filename, lf.backup(1)); err != nil {
+		return fmt.Errorf("rotate log: %w", err)
+	}
+	return nil
+}
+
+func (lf *LogFile) backup(index int) string {
+	return fmt.Sprintf("%s.%d", lf.filename, index)
+}
+
+// save complete lines to ring buffer
+func (lf *LogFile) remember(data []byte) {
+	if len(lf.lines) == 0 {
+		return
+	}
+	for {
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			break
+		}
+		line := string(append(lf.partial, bytes.TrimRight(data[:idx], "\r")...))
+		lf.partial = lf.partial[:0]
+		lf.lines[lf.next] = line
+		lf.next = (lf.next + 1) % len(lf.lines)
+		if lf.next == 0 {
+			lf.full = true
+		}
+		data = data[idx+1:]
+	}
+	lf.partial = append(lf.partial, data...)
+}
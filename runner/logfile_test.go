@@ -0,0 +1,84 @@
+package runner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLogFile_rotation(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	filename := filepath.Join(tmp, LogFileName)
+	if err := ioutil.WriteFile(filename, []byte("previous run\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logfile, err := OpenLog(filename, LogPolicy{MaxSize: 10, MaxBackups: 2, TailLines: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logfile.Close()
+	if data, _ := ioutil.ReadFile(filename + ".1"); string(data) != "previous run\n" {
+		t.Errorf("previous log not kept: %q", data)
+	}
+	for _, chunk := range []string{"first\n", "sec", "ond\n", "third\n"} {
+		if _, err := logfile.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tail := logfile.Tail(0); !reflect.DeepEqual(tail, []string{"second", "third"}) {
+		t.Errorf("unexpected tail: %v", tail)
+	}
+	if data, _ := ioutil.ReadFile(filename); string(data) != "ond\nthird\n" {
+		t.Errorf("unexpected current log: %q", data)
+	}
+	if data, _ := ioutil.ReadFile(filename + ".2"); string(data) != "previous run\n" {
+		t.Errorf("oldest log not kept: %q", data)
+	}
+	if _, err := os.Stat(filename + ".3"); !os.IsNotExist(err) {
+		t.Error("retention not applied")
+	}
+}
+
+func TestLogFile_failedRotation(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	filename := filepath.Join(tmp, LogFileName)
+	// backup location is occupied by non-empty directory, so rotation fails
+	if err := os.MkdirAll(filepath.Join(filename+".1", "busy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	lf, err := OpenLog(filename, LogPolicy{MaxSize: 10, MaxBackups: 1, TailLines: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"0123456789\n", "abc\n"} {
+		if _, err := lf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "0123456789\nabc\n" {
+		t.Errorf("output should be kept in current file, got %q", data)
+	}
+	if err := lf.Close(); err != nil {
+		t.Error(err)
+	}
+	if n, err := lf.Write([]byte("closed\n")); err != nil || n != 7 {
+		t.Errorf("write after close should be dropped silently: %d, %v", n, err)
+	}
+	if tail := lf.Tail(1); len(tail) != 1 || tail[0] != "closed" {
+		t.Errorf("unexpected tail: %v", tail)
+	}
+}
@@ -0,0 +1,48 @@
+package runner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Check that process from PID file (as written by tincd) is still alive and it is tincd (PID of stale file could be
+// reused by another process). Returns PID and true if process exists. Missing or malformed PID file treated as no
+// running instance.
+func RunningInstance(pidfile string) (int, bool) {
+	data, err := ioutil.ReadFile(pidfile)
+	if err != nil {
+		return 0, false
+	}
+	// tinc 1.0: "<pid>", tinc 1.1: "<pid> <cookie> <host> port <port>"
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil || pid <= 0 {
+		return 0, false
+	}
+	if !isProcessAlive(pid) {
+		return pid, false
+	}
+	if name, err := processName(pid); err == nil && !isTincd(name) {
+		return pid, false
+	}
+	return pid, true
+}
+
+func isTincd(name string) bool {
+	name = strings.ToLower(name)
+	return name == "tincd" || name == "tincd.exe"
+}
+
+// Ask running tincd (by PID file) to dump nodes, edges and subnets to log (SIGUSR2). Nodes dump contains path MTU
+func DumpNodes(pidfile string) error {
+	pid, running := RunningInstance(pidfile)
+	if !running {
+		return fmt.Errorf("no running tincd instance for %s", pidfile)
+	}
+	return dumpProcess(pid)
+}
@@ -0,0 +1,49 @@
+//+build linux darwin
+
+package runner
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestRunningInstance(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	pidfile := filepath.Join(tmp, "pid.run")
+	if _, running := RunningInstance(pidfile); running {
+		t.Error("missing PID file should not be running")
+	}
+
+	// PID reused by another process
+	if err := ioutil.WriteFile(pidfile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, running := RunningInstance(pidfile); running {
+		t.Error("process is not tincd")
+	}
+
+	fake := filepath.Join(tmp, "tincd")
+	if err := ioutil.WriteFile(fake, []byte("#!/bin/sh\nwhile true; do sleep 0.1; done\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(fake)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	if err := ioutil.WriteFile(pidfile, []byte(strconv.Itoa(cmd.Process.Pid)+" cookie 127.0.0.1 port 655\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if pid, running := RunningInstance(pidfile); !running || pid != cmd.Process.Pid {
+		t.Errorf("tincd %d should be running", cmd.Process.Pid)
+	}
+}
@@ -0,0 +1,17 @@
+package runner
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// name of process executable
+func processName(pid int) (string, error) {
+	out, err := exec.Command("ps", "-p", strconv.Itoa(pid), "-o", "comm=").Output()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(strings.TrimSpace(string(out))), nil
+}
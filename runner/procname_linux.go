@@ -0,0 +1,16 @@
+package runner
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// name of process executable (comm is readable even for processes of other users)
+func processName(pid int) (string, error) {
+	data, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/comm")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,27 @@
+package runner
+
+import (
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const processQueryLimitedInformation = 0x1000
+
+var procQueryFullProcessImageName = syscall.NewLazyDLL("kernel32.dll").NewProc("QueryFullProcessImageNameW")
+
+// name of process executable
+func processName(pid int) (string, error) {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return "", err
+	}
+	defer syscall.CloseHandle(handle)
+	var buf [syscall.MAX_PATH]uint16
+	size := uint32(len(buf))
+	r, _, err := procQueryFullProcessImageName.Call(uintptr(handle), 0, uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)))
+	if r == 0 {
+		return "", err
+	}
+	return filepath.Base(syscall.UTF16ToString(buf[:size])), nil
+}
@@ -0,0 +1,68 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Timeout of tincd version probe
+const ProbeTimeout = 10 * time.Second
+
+// Version of tincd is not supported (supported 1.0 and 1.1)
+var ErrUnsupportedVersion = errors.New("unsupported tincd version")
+
+// tinc version 1.0.36 (built Jul 18 2020 12:00:00, protocol 17)
+// tinc version 1.1pre17 (built Oct  8 2018 20:27:02, protocol 17.7)
+var versionPattern = regexp.MustCompile(`tinc version (\d+)\.(\d+)(?:\.(\d+)|pre(\d+))?`)
+
+// Version and features of tincd binary
+type Capabilities struct {
+	Version       string // as reported by tincd (ex: 1.0.36, 1.1pre17)
+	Major         int
+	Minor         int
+	Patch         int  // patch for release or number of pre-release (1.1preN)
+	ControlSocket bool // control socket: debug level, disconnect and so on (tinc 1.1)
+	NodesDump     bool // nodes dump with path MTU by SIGUSR2 (tinc 1.0, in 1.1 the signal terminates tincd)
+	Ed25519       bool // Ed25519 keys and SPTPS protocol (tinc 1.1), RSA keys are supported by all versions
+}
+
+// Probe version of tincd binary (tincd --version) and detect features. Returns ErrUnsupportedVersion for versions
+// other than 1.0 and 1.1
+func Probe(ctx context.Context, tincBin string) (*Capabilities, error) {
+	ctx, cancel := context.WithTimeout(ctx, ProbeTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, tincBin, "--version")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("probe version of %s: %w", tincBin, err)
+	}
+	return parseVersion(string(out))
+}
+
+func parseVersion(output string) (*Capabilities, error) {
+	match := versionPattern.FindStringSubmatch(output)
+	if match == nil {
+		return nil, fmt.Errorf("%w: unknown version output %q", ErrUnsupportedVersion, output)
+	}
+	var caps Capabilities
+	caps.Version = match[0][len("tinc version "):]
+	caps.Major, _ = strconv.Atoi(match[1])
+	caps.Minor, _ = strconv.Atoi(match[2])
+	if match[3] != "" {
+		caps.Patch, _ = strconv.Atoi(match[3])
+	} else if match[4] != "" {
+		caps.Patch, _ = strconv.Atoi(match[4])
+	}
+	if caps.Major != 1 || caps.Minor > 1 {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedVersion, caps.Version)
+	}
+	caps.ControlSocket = caps.Minor >= 1
+	caps.NodesDump = caps.Minor == 0
+	caps.Ed25519 = caps.Minor >= 1
+	return &caps, nil
+}
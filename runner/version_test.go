@@ -0,0 +1,28 @@
+package runner
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	caps, err := parseVersion("tinc version 1.0.36 (built Jul 18 2020 12:00:00, protocol 17)\nCopyright (C) 1998-2019 Ivo Timmermans, Guus Sliepen and others.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.Version != "1.0.36" || caps.Patch != 36 || !caps.NodesDump || caps.ControlSocket {
+		t.Errorf("unexpected capabilities of 1.0: %+v", caps)
+	}
+	caps, err = parseVersion("tinc version 1.1pre17 (built Oct  8 2018 20:27:02, protocol 17.7)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.Version != "1.1pre17" || caps.Minor != 1 || caps.NodesDump || !caps.ControlSocket || !caps.Ed25519 {
+		t.Errorf("unexpected capabilities of 1.1: %+v", caps)
+	}
+	for _, output := range []string{"tinc version 2.0.0 (built)", "tinc version 0.9", "tincd: unknown option"} {
+		if _, err := parseVersion(output); !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("%q should not be supported: %v", output, err)
+		}
+	}
+}
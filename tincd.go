@@ -5,43 +5,84 @@ import (
 	"fmt"
 	"github.com/tinc-boot/tincd/internal"
 	"github.com/tinc-boot/tincd/network"
+	"github.com/tinc-boot/tincd/runner"
 	"net"
 	"path/filepath"
+	"time"
 )
 
 // Base TINCD running instance. All methods should be goroutine safe
 type Tincd interface {
 	// Events bus
 	Events() *network.Events
-	// Stop service. Non-blocking, could be called several times
-	Stop()
-	// Get last service error (if exists)
+	// Stop service. Non-blocking, could be called several times. Tincd is asked to stop gracefully (runs tinc-down
+	// and notifies peers) and killed after grace period (see WithGracePeriod) or optional deadline
+	Stop(deadline ...time.Time)
+	// Get last service error (if exists). After tincd exit it is ErrTincExited (unless other component failed)
 	Error() error
 	// Get wait channel. Will be close after stop
 	Done() <-chan struct{}
+	// Last lines (all kept if lines <= 0) of tincd log from memory (see WithLogPolicy)
+	Logs(lines int) []string
 	// Check that service is still running
 	IsRunning() bool
 	// Check that node (by name) is connected to the network
 	IsActive(node string) bool
 	// List of all connected peers
 	Peers() []string
+	// Version and features of tincd binary
+	Capabilities() runner.Capabilities
+	// Path MTU to connected peers as discovered by tincd (refreshed every PathMTUInterval, tinc 1.0 only, not
+	// supported on Windows)
+	PathMTU() map[string]int
 	// Get network definition
 	Definition() *network.Network
+	// Dial address over VPN. Host could be node name, <node>.<network> or VPN IP. Works in kernel and userspace modes
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+	// Listen TCP port on VPN address of self node. Works in kernel and userspace modes
+	Listen(port int) (net.Listener, error)
+	// Reload configuration and host files (SIGHUP or control socket)
+	Reload() error
+	// Forget information about unreachable nodes (SIGWINCH or control socket)
+	Purge() error
+	// Retry outgoing connections immediately (SIGALRM or control socket)
+	Retry() error
+	// Change debug level of tincd. Requires tinc 1.1 (control socket)
+	SetDebugLevel(level int) error
+	// Connect to public node immediately
+	Connect(node string) error
+	// Close meta connection with node. Requires tinc 1.1 (control socket)
+	Disconnect(node string) error
 }
 
-// Start tincd (and tinc-web-boot protocol) services. Not blocking after start. If sudo is true it will try to ask
-// administrative privileges for each platform (graphically if possible)
-func Start(ctx context.Context, nw *network.Network, sudo bool) (*netImpl, error) {
+// Start tincd (and tinc-web-boot protocol) services. Not blocking after start. Version of tincd is probed before
+// start (ErrUnsupportedVersion for versions other than 1.0 and 1.1). If sudo is true it will try to ask
+// administrative privileges for each platform (graphically if possible), or will use privileged helper if it was
+// started before (see runner.StartHelper)
+func Start(ctx context.Context, nw *network.Network, sudo bool, options ...Option) (*netImpl, error) {
 	if !nw.IsDefined() {
-		return nil, fmt.Errorf("network %s is not defined", nw.Name())
+		return nil, fmt.Errorf("%w: %s", ErrNotDefined, nw.Name())
+	}
+	if pid, running := runner.RunningInstance(nw.Pidfile()); running {
+		return nil, fmt.Errorf("%w: network %s, pid %d", ErrAlreadyRunning, nw.Name(), pid)
 	}
 	tincBin, err := internal.DetectTincBinary()
 	if err != nil {
-		return nil, fmt.Errorf("detect tinc binary: %w", err)
+		return nil, fmt.Errorf("%w: %v", ErrTincNotFound, err)
+	}
+	caps, err := runner.Probe(ctx, tincBin)
+	if err != nil {
+		return nil, err
 	}
 	impl := &netImpl{
 		definition: nw,
 		tincBin:    tincBin,
+		caps:       *caps,
+		grace:      DefaultGracePeriod,
+		logPolicy:  runner.DefaultLogPolicy,
+	}
+	for _, option := range options {
+		option(impl)
 	}
 	return impl, impl.initAndStart(ctx, sudo)
 }
@@ -49,18 +90,18 @@ func Start(ctx context.Context, nw *network.Network, sudo bool) (*netImpl, error
 // Start tincd (and tinc-web-boot protocol) services based on configuration in directory. Not blocking after start.
 // If sudo is true it will try to ask
 // administrative privileges for each platform (graphically if possible)
-func StartFromDir(ctx context.Context, directory string, sudo bool) (*netImpl, error) {
+func StartFromDir(ctx context.Context, directory string, sudo bool, options ...Option) (*netImpl, error) {
 	abs, err := filepath.Abs(directory)
 	if err != nil {
 		return nil, err
 	}
-	return Start(ctx, &network.Network{Root: abs}, sudo)
+	return Start(ctx, &network.Network{Root: abs}, sudo, options...)
 }
 
-// Create (but not start) and configure new network in specified location with pre-parsed subnet. IP will be generated
-// randomly.
+// Create (but not start) and configure new network in specified location with pre-parsed subnets (one IPv4 and/or one
+// IPv6). IP will be generated randomly.
 // Base name of the location will be used as name of network.
-func CreateNet(location string, subnet *net.IPNet) (*network.Network, error) {
+func CreateNet(location string, subnets ...*net.IPNet) (*network.Network, error) {
 	abs, err := filepath.Abs(location)
 	if err != nil {
 		return nil, err
@@ -68,19 +109,23 @@ func CreateNet(location string, subnet *net.IPNet) (*network.Network, error) {
 	name := filepath.Base(abs)
 
 	if !network.IsValidName(name) {
-		return nil, fmt.Errorf("invalid network name")
+		return nil, network.ErrInvalidName
 	}
 	netw := &network.Network{Root: abs}
-	return netw, netw.Configure(subnet)
+	return netw, netw.Configure(subnets...)
 }
 
-// Create (but not start) and configure new network in specified location. Subnet should be defined in CIDR.
-// IP will be generated randomly.
+// Create (but not start) and configure new network in specified location. Subnets (one IPv4 and/or one IPv6) should
+// be defined in CIDR. IP will be generated randomly.
 // Base name of the location will be used as name of network.
-func Create(location string, subnet string) (*network.Network, error) {
-	_, ipnet, err := net.ParseCIDR(subnet)
-	if err != nil {
-		return nil, err
+func Create(location string, subnets ...string) (*network.Network, error) {
+	var parsed = make([]*net.IPNet, 0, len(subnets))
+	for _, subnet := range subnets {
+		_, ipnet, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, ipnet)
 	}
-	return CreateNet(location, ipnet)
+	return CreateNet(location, parsed...)
 }
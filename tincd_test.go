@@ -1,8 +1,14 @@
 package tincd
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"testing"
 )
 
@@ -23,3 +29,65 @@ func TestCreate(t *testing.T) {
 	}
 	t.Logf("%+v", ntw)
 }
+
+func TestCreateDualStack(t *testing.T) {
+	const netName = "dualstack"
+
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	path := filepath.Join(tmp, netName)
+
+	ntw, err := Create(path, "10.10.0.0/16", "fd00:10::/64")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	self, err := ntw.Self()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if self.IP == "" || self.IP6 == "" {
+		t.Errorf("both addresses should be assigned: %+v", self)
+	}
+	t.Logf("%+v", self)
+}
+
+func TestStart_alreadyRunning(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake tincd is a shell script")
+	}
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	ntw, err := Create(filepath.Join(tmp, "running"), "10.10.0.0/16")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	fake := filepath.Join(tmp, "tincd")
+	if err := ioutil.WriteFile(fake, []byte("#!/bin/sh\nwhile true; do sleep 0.1; done\n"), 0755); err != nil {
+		t.Error(err)
+		return
+	}
+	cmd := exec.Command(fake)
+	if err := cmd.Start(); err != nil {
+		t.Error(err)
+		return
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	if err := ioutil.WriteFile(ntw.Pidfile(), []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := Start(context.Background(), ntw, false); !errors.Is(err, ErrAlreadyRunning) {
+		t.Error("second tincd instance should be rejected:", err)
+	}
+}
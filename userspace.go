@@ -0,0 +1,82 @@
+package tincd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/reddec/jsonrpc2"
+	"github.com/tinc-boot/tincd/internal/api"
+	"github.com/tinc-boot/tincd/internal/api/impl/apiclient"
+	"github.com/tinc-boot/tincd/network"
+	"github.com/tinc-boot/tincd/userspace"
+	"net/http"
+	"sync/atomic"
+)
+
+// attach multicast device to stack and serve it until context canceled
+func (impl *netImpl) serveStack(ctx context.Context, config *network.Config, self *network.Node) error {
+	device, err := userspace.Open(config.Device)
+	if err != nil {
+		return err
+	}
+	defer device.Close()
+	go func() {
+		<-ctx.Done()
+		_ = device.Close()
+	}()
+	return impl.stack.Serve(ctx, device, config.InterfaceAddresses(self))
+}
+
+// client of tinc-boot API over stack (if defined) or over kernel interface
+func (impl *netImpl) apiClient(baseURL string) api.API {
+	if impl.stack == nil {
+		return &rpcErrorsClient{API: &apiclient.APIClient{BaseURL: baseURL}}
+	}
+	return &rpcErrorsClient{API: &stackClient{
+		baseURL: baseURL,
+		client: &http.Client{Transport: &http.Transport{
+			DialContext: impl.DialContext,
+		}},
+	}}
+}
+
+// JSON-RPC client of API over userspace stack (generated client always uses default HTTP client)
+type stackClient struct {
+	baseURL  string
+	client   *http.Client
+	sequence uint64
+}
+
+func (sc *stackClient) Exchange(ctx context.Context, self network.Node) ([]network.Node, error) {
+	data, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "API.Exchange",
+		"id":      atomic.AddUint64(&sc.sequence, 1),
+		"params":  []interface{}{self},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sc.baseURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	res, err := sc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("exchange via %s: status code %d", sc.baseURL, res.StatusCode)
+	}
+	var nodes []network.Node
+	var reply = jsonrpc2.Response{Result: &nodes}
+	if err := json.NewDecoder(res.Body).Decode(&reply); err != nil {
+		return nil, fmt.Errorf("exchange via %s: parse response: %w", sc.baseURL, err)
+	}
+	if reply.Error != nil {
+		return nil, reply.Error
+	}
+	return nodes, nil
+}
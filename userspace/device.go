@@ -0,0 +1,99 @@
+// Package userspace terminates traffic of tincd multicast device (DeviceType = multicast) in user space, so VPN
+// could be used without kernel TAP device and without administrative privileges.
+//
+// Package does not contain TCP/IP stack: it should be provided by embedding application (ex: gVisor netstack)
+// as implementation of Stack interface.
+//
+// Security note: frames in the multicast group are not encrypted and the group is not protected by file permissions,
+// so every process on the host (of any user) could join it and read or inject VPN traffic. Do not use userspace
+// mode on shared multi-user hosts.
+package userspace
+
+import (
+	"crypto/rand"
+	"fmt"
+	"golang.org/x/net/ipv4"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const ethernetHeader = 14
+
+// Ethernet frames exchanged with tincd through local multicast group
+type Device struct {
+	conn  *net.UDPConn
+	group *net.UDPAddr
+	mac   net.HardwareAddr
+}
+
+// Open multicast device as defined in tinc configuration: "<group address> <port> [ttl]"
+func Open(device string) (*Device, error) {
+	fields := strings.Fields(device)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid multicast device %s", device)
+	}
+	group, err := net.ResolveUDPAddr("udp4", net.JoinHostPort(fields[0], fields[1]))
+	if err != nil {
+		return nil, fmt.Errorf("parse multicast device %s: %w", device, err)
+	}
+	ttl := 1
+	if len(fields) > 2 {
+		ttl, err = strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("parse multicast TTL %s: %w", fields[2], err)
+		}
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return nil, fmt.Errorf("join multicast group %s: %w", group, err)
+	}
+	control := ipv4.NewPacketConn(conn)
+	if err := control.SetMulticastTTL(ttl); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("set multicast TTL: %w", err)
+	}
+	if err := control.SetMulticastLoopback(true); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("enable multicast loopback: %w", err)
+	}
+	mac := make(net.HardwareAddr, 6)
+	if _, err := rand.Read(mac); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	mac[0] = (mac[0] | 0x02) & 0xfe // locally administered unicast
+	return &Device{conn: conn, group: group, mac: mac}, nil
+}
+
+// Link address which should be used by stack as source of frames. Frames from this address are not returned by
+// ReadFrame (multicast loopback)
+func (dev *Device) MAC() net.HardwareAddr {
+	return dev.mac
+}
+
+// Read next ethernet frame sent by tincd
+func (dev *Device) ReadFrame(frame []byte) (int, error) {
+	for {
+		n, _, err := dev.conn.ReadFromUDP(frame)
+		if err != nil {
+			return 0, err
+		}
+		if n < ethernetHeader || net.HardwareAddr(frame[6:12]).String() == dev.mac.String() {
+			// too short or own frame
+			continue
+		}
+		return n, nil
+	}
+}
+
+// Send ethernet frame to tincd
+func (dev *Device) WriteFrame(frame []byte) error {
+	_, err := dev.conn.WriteToUDP(frame, dev.group)
+	return err
+}
+
+// Close device. Blocked ReadFrame returns error
+func (dev *Device) Close() error {
+	return dev.conn.Close()
+}
@@ -0,0 +1,45 @@
+package userspace
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestDevice_Frames(t *testing.T) {
+	const definition = "239.255.10.20 35123 0"
+	tincd, err := Open(definition)
+	if err != nil {
+		t.Skip("multicast not available:", err)
+	}
+	defer tincd.Close()
+	stack, err := Open(definition)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer stack.Close()
+
+	frame := make([]byte, 64)
+	copy(frame[6:12], stack.MAC())
+	copy(frame[14:], "hello")
+	if err := stack.WriteFrame(frame); err != nil {
+		t.Error(err)
+		return
+	}
+	_ = tincd.conn.SetReadDeadline(time.Now().Add(time.Second))
+	var buf = make([]byte, 1500)
+	n, err := tincd.ReadFrame(buf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(buf[:n], frame) {
+		t.Errorf("unexpected frame: %v", buf[:n])
+	}
+	// own frames are skipped
+	_ = stack.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := stack.ReadFrame(buf); err == nil {
+		t.Error("own frame returned")
+	}
+}
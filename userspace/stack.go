@@ -0,0 +1,18 @@
+package userspace
+
+import (
+	"context"
+	"net"
+)
+
+// Userspace TCP/IP stack (ex: gVisor netstack) attached to VPN through Device. No implementation is provided by
+// the library: stack should exchange ethernet frames (with ARP and IPv6 neighbor discovery) by Device.ReadFrame and
+// Device.WriteFrame using Device.MAC as own address.
+type Stack interface {
+	// Serve device with assigned VPN addresses until context canceled. Device is closed after return
+	Serve(ctx context.Context, device *Device, addresses []*net.IPNet) error
+	// Dial address over VPN
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+	// Listen address over VPN
+	Listen(network, address string) (net.Listener, error)
+}
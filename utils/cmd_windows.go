@@ -7,6 +7,7 @@ import (
 
 func SetCmdAttrs(cmd *exec.Cmd) {
 	cmd.SysProcAttr = &syscall.SysProcAttr{
-		HideWindow: true,
+		HideWindow:    true,
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP, // to receive CTRL_BREAK_EVENT without the parent
 	}
 }